@@ -0,0 +1,3 @@
+module github.com/tesnikio/tinkoff-golang/HWs
+
+go 1.17
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+type candlePoint struct {
+	timestamp time.Time
+	open      decimal.Decimal
+	high      decimal.Decimal
+	low       decimal.Decimal
+	close     decimal.Decimal
+	volume    int64
+	vwap      decimal.Decimal
+}
+
+type tradeWindow struct {
+	buyTime  time.Time
+	sellTime time.Time
+}
+
+func (w tradeWindow) holding() time.Duration {
+	return w.sellTime.Sub(w.buyTime)
+}
+
+type maxRevenue struct {
+	revenue   decimal.Decimal
+	buyPrice  decimal.Decimal
+	sellPrice decimal.Decimal
+	tradeWindow
+}
+
+// windowPolicy picks one of several windows that give the same max revenue.
+type windowPolicy int
+
+const (
+	earliestWindow windowPolicy = iota
+	shortestWindow
+	latestWindow
+)
+
+func parseWindowPolicy(name string) (windowPolicy, error) {
+	switch strings.ToLower(name) {
+	case "earliest":
+		return earliestWindow, nil
+	case "shortest":
+		return shortestWindow, nil
+	case "latest":
+		return latestWindow, nil
+	default:
+		return earliestWindow, fmt.Errorf("unknown window policy %q, expected earliest, shortest or latest", name)
+	}
+}
+
+// prefers tells whether candidate should replace current when both give the same revenue.
+func (p windowPolicy) prefers(candidate, current tradeWindow) bool {
+	switch p {
+	case shortestWindow:
+		if candidate.holding() != current.holding() {
+			return candidate.holding() < current.holding()
+		}
+
+		return candidate.buyTime.Before(current.buyTime)
+	case latestWindow:
+		if !candidate.sellTime.Equal(current.sellTime) {
+			return candidate.sellTime.After(current.sellTime)
+		}
+
+		return candidate.buyTime.After(current.buyTime)
+	default:
+		if !candidate.buyTime.Equal(current.buyTime) {
+			return candidate.buyTime.Before(current.buyTime)
+		}
+
+		return candidate.sellTime.Before(current.sellTime)
+	}
+}
+
+// bestTrade looks for the best single round trip of a ticker while its candles are
+// streamed in chronological order: buy at the low of one candle and sell at the high
+// of a strictly later one.
+type bestTrade struct {
+	maxRevenue
+	found  bool
+	policy windowPolicy
+
+	// All candles sharing the lowest low seen so far. Only the first and the last one
+	// are needed to apply the policy, the full list is kept when all windows are reported.
+	minLow       decimal.Decimal
+	firstMinLow  time.Time
+	lastMinLow   time.Time
+	minLowTimes  []time.Time
+	collectAll   bool
+	windows      []tradeWindow
+	first        time.Time
+	last         time.Time
+	candlesCount int
+}
+
+func newBestTrade(policy windowPolicy, allWindows bool) *bestTrade {
+	return &bestTrade{policy: policy, collectAll: allWindows}
+}
+
+func (b *bestTrade) add(point candlePoint) error {
+	if b.candlesCount > 0 && point.timestamp.Before(b.last) {
+		return fmt.Errorf("candle at %s goes after %s", point.timestamp.Format(time.RFC3339), b.last.Format(time.RFC3339))
+	}
+
+	if b.candlesCount > 0 {
+		b.addSell(point)
+	} else {
+		b.first = point.timestamp
+	}
+
+	switch {
+	case b.candlesCount == 0 || point.low.LessThan(b.minLow):
+		b.minLow = point.low
+		b.firstMinLow = point.timestamp
+		b.lastMinLow = point.timestamp
+
+		if b.collectAll {
+			b.minLowTimes = append(b.minLowTimes[:0], point.timestamp)
+		}
+	case point.low.Equal(b.minLow):
+		b.lastMinLow = point.timestamp
+
+		if b.collectAll {
+			b.minLowTimes = append(b.minLowTimes, point.timestamp)
+		}
+	}
+
+	b.last = point.timestamp
+	b.candlesCount++
+
+	return nil
+}
+
+func (b *bestTrade) addSell(point candlePoint) {
+	revenue := point.high.Sub(b.minLow)
+
+	buyTime := b.lastMinLow
+	if b.policy == earliestWindow {
+		buyTime = b.firstMinLow
+	}
+
+	candidate := maxRevenue{
+		revenue:     revenue,
+		buyPrice:    b.minLow,
+		sellPrice:   point.high,
+		tradeWindow: tradeWindow{buyTime: buyTime, sellTime: point.timestamp},
+	}
+
+	cmp := revenue.Cmp(b.revenue)
+
+	switch {
+	case !b.found || cmp > 0:
+		b.maxRevenue = candidate
+		b.found = true
+		b.windows = b.windows[:0]
+	case cmp == 0:
+		if b.policy.prefers(candidate.tradeWindow, b.tradeWindow) {
+			b.maxRevenue = candidate
+		}
+	default:
+		return
+	}
+
+	if b.collectAll {
+		for _, buyTime := range b.minLowTimes {
+			b.windows = append(b.windows, tradeWindow{buyTime: buyTime, sellTime: point.timestamp})
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/csv"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+)
+
+// buildCandles runs hw3 on its test trades and returns the path of its 5 minute candles.
+func buildCandles(t *testing.T) string {
+	t.Helper()
+
+	if testing.Short() {
+		t.Skip("builds hw3")
+	}
+
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go tool to build hw3")
+	}
+
+	trades, err := filepath.Abs(filepath.Join("..", "hw3", "testdata", "trades.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	hw3 := filepath.Join(dir, "hw3")
+
+	if out, err := exec.Command(goTool, "build", "-o", hw3, "../hw3").CombinedOutput(); err != nil {
+		t.Fatalf("can't build hw3: %s\n%s", err, out)
+	}
+
+	run := exec.Command(hw3, "-file", trades, "-timeframes", "5m", "-order", "time-ticker", "-timeout", "0")
+	run.Dir = dir
+
+	if out, err := run.CombinedOutput(); err != nil {
+		t.Fatalf("hw3 failed: %s\n%s", err, out)
+	}
+
+	return filepath.Join(dir, "candles_5m.csv")
+}
+
+// candleRows reads the candles of filename with readCandles in the ticker,time,open,
+// high,low,close,volume,vwap form of the hw3 columns.
+func candleRows(t *testing.T, filename string) [][]string {
+	t.Helper()
+
+	var rows [][]string
+
+	err := readCandles(filename, recordFilter{}, func(ticker string, point candlePoint) error {
+		rows = append(rows, []string{
+			ticker,
+			point.timestamp.Format(time.RFC3339),
+			point.open.String(),
+			point.high.String(),
+			point.low.String(),
+			point.close.String(),
+			strconv.FormatInt(point.volume, 10),
+			point.vwap.String(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rows
+}
+
+// TestReadHW3Candles reads the candles hw3 writes, as they are, with a header row and with
+// malformed rows that hw1 skips.
+func TestReadHW3Candles(t *testing.T) {
+	filename := buildCandles(t)
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) == 0 {
+		t.Fatal("hw3 wrote no candles")
+	}
+
+	want := make([][]string, len(records))
+	for i, record := range records {
+		// The turnover and the trade count are not read by hw1.
+		want[i] = append(append([]string{}, record[:7]...), record[9])
+	}
+
+	// The first row has all the columns, as it decides whether a file without a header
+	// has the optional ones.
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	malformed := append([]string{"AAPL,2019-01-30T07:00:00Z,x,1,1,1,1,1,1,1\n"}, lines[:len(lines)/2]...)
+	malformed = append(malformed, "AAPL,yesterday,1,1,1,1,1,1,1,1\n", "\n", "SBER,2019-01-30T07:00:00Z,1,1\n")
+	malformed = append(malformed, lines[len(lines)/2:]...)
+
+	tests := map[string]string{
+		"as written":  string(data),
+		"header":      strings.Join(candle.Columns, ",") + "\n" + string(data),
+		"upper case":  strings.ToUpper(strings.Join(candle.Columns, ",")) + "\n" + string(data),
+		"malformed":   strings.Join(malformed, ""),
+		"header, bad": strings.Join(candle.Columns, ",") + "\n" + strings.Join(malformed, ""),
+	}
+
+	for name, input := range tests {
+		filename := filepath.Join(t.TempDir(), "candles_5m.csv")
+		if err := ioutil.WriteFile(filename, []byte(input), 0o644); err != nil { //nolint
+			t.Fatal(err)
+		}
+
+		if got := candleRows(t, filename); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got\n%v\nwant\n%v", name, got, want)
+		}
+	}
+}
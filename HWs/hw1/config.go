@@ -0,0 +1,179 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type config struct {
+	candlesFile         string
+	tradesFile          string
+	outputFile          string
+	openPositionsFile   string
+	windowsFile         string
+	windowPolicy        windowPolicy
+	leaderboardFile     string
+	rejectsFile         string
+	anomaliesFile       string
+	anomalySummaryFile  string
+	executionFile       string
+	executionTradesFile string
+	feesFile            string
+	pnlFile             string
+	instrumentsFile     string
+	fxFile              string
+	currency            string
+	candleInterval      time.Duration
+	top                 int
+	bottom              int
+	output              outputOptions
+	filter              recordFilter
+}
+
+// recordFilter limits the report to some tickers and to the [from, to) time range.
+// Empty fields mean no limit.
+type recordFilter struct {
+	tickers map[string]struct{}
+	from    time.Time
+	to      time.Time
+}
+
+func (f recordFilter) match(ticker string, timestamp time.Time) bool {
+	if len(f.tickers) > 0 {
+		if _, ok := f.tickers[ticker]; !ok {
+			return false
+		}
+	}
+
+	if !f.from.IsZero() && timestamp.Before(f.from) {
+		return false
+	}
+
+	if !f.to.IsZero() && !timestamp.Before(f.to) {
+		return false
+	}
+
+	return true
+}
+
+func parseTickers(list string) map[string]struct{} {
+	tickers := make(map[string]struct{})
+	for _, ticker := range strings.Split(list, ",") {
+		if ticker = normalizeTicker(ticker); ticker != "" {
+			tickers[ticker] = struct{}{}
+		}
+	}
+
+	return tickers
+}
+
+func parseTime(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid -%s: %s", name, err)
+	}
+
+	return timestamp, nil
+}
+
+func parseFlags(name string, args []string) (config, error) {
+	var (
+		cfg     config
+		tickers string
+		from    string
+		to      string
+		format  string
+		policy  string
+	)
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	flags.StringVar(&cfg.candlesFile, "candles", "candles_5m.csv", "candles input file, CSV or columnar")
+	flags.StringVar(&cfg.tradesFile, "trades", "user_trades.csv", "user trades input file, CSV or columnar")
+	flags.StringVar(&cfg.outputFile, "output", "result.csv", "report output file, - for stdout")
+	flags.StringVar(&cfg.openPositionsFile, "open-positions", "", "write the open positions to this file")
+	flags.StringVar(&cfg.windowsFile, "windows", "", "write every max revenue window per ticker to this file")
+	flags.StringVar(&policy, "window-policy", "earliest",
+		"best trade window to report when several give the max revenue: earliest, shortest or latest")
+	flags.StringVar(&cfg.leaderboardFile, "leaderboard", "", "write users ranked by efficiency to this file")
+	flags.IntVar(&cfg.top, "top", 0, "keep only the best N users of every currency in the leaderboard")
+	flags.IntVar(&cfg.bottom, "bottom", 0, "keep only the worst N users of every currency in the leaderboard")
+	flags.StringVar(&cfg.rejectsFile, "rejects", "", "write rejected trades with the reason to this file")
+	flags.StringVar(&cfg.anomaliesFile, "anomalies", "",
+		"reconcile fills with their candles and write fills outside the candle range to this file")
+	flags.StringVar(&cfg.anomalySummaryFile, "anomaly-summary", "",
+		"reconcile fills with their candles and write per-ticker anomaly counts to this file")
+	flags.StringVar(&cfg.executionFile, "execution", "",
+		"write execution quality of fills against their candles per user and ticker to this file")
+	flags.StringVar(&cfg.executionTradesFile, "execution-trades", "",
+		"write execution quality of every fill to this file")
+	flags.StringVar(&cfg.feesFile, "fees", "", "fee model config file, no fees by default")
+	flags.StringVar(&cfg.pnlFile, "pnl", "", "write gross PnL, fees and net PnL per user to this file")
+	flags.StringVar(&cfg.instrumentsFile, "instruments", "",
+		"instruments table with ticker,currency,lot_size,price_step rows")
+	flags.StringVar(&cfg.fxFile, "fx", "", "exchange rates with base,quote,timestamp,rate rows")
+	flags.StringVar(&cfg.currency, "currency", "", "convert per-user PnL into this currency, needs -instruments and -fx")
+	flags.DurationVar(&cfg.candleInterval, "interval", 5*time.Minute, "candle interval, used to check trade coverage")
+	flags.StringVar(&tickers, "tickers", "", "comma-separated tickers to report, all by default")
+	flags.StringVar(&from, "from", "", "skip candles and trades before this RFC3339 time")
+	flags.StringVar(&to, "to", "", "skip candles and trades at or after this RFC3339 time")
+	flags.BoolVar(&cfg.output.header, "header", false, "write a header row")
+	flags.StringVar(&format, "format", "csv", "output format: csv, json or table")
+
+	if err := flags.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if flags.NArg() > 0 {
+		return cfg, usageError(flags, fmt.Errorf("unexpected arguments: %v", flags.Args()))
+	}
+
+	var err error
+
+	if cfg.output.format, err = parseOutputFormat(format); err != nil {
+		return cfg, usageError(flags, err)
+	}
+
+	if cfg.candleInterval <= 0 {
+		return cfg, usageError(flags, fmt.Errorf("-interval must be positive"))
+	}
+
+	cfg.currency = strings.ToUpper(cfg.currency)
+	if cfg.currency != "" && (cfg.instrumentsFile == "" || cfg.fxFile == "") {
+		return cfg, usageError(flags, fmt.Errorf("-currency needs -instruments and -fx"))
+	}
+
+	if cfg.top < 0 || cfg.bottom < 0 {
+		return cfg, usageError(flags, fmt.Errorf("-top and -bottom can't be negative"))
+	}
+
+	if cfg.windowPolicy, err = parseWindowPolicy(policy); err != nil {
+		return cfg, usageError(flags, err)
+	}
+
+	cfg.filter.tickers = parseTickers(tickers)
+
+	if cfg.filter.from, err = parseTime("from", from); err != nil {
+		return cfg, usageError(flags, err)
+	}
+
+	if cfg.filter.to, err = parseTime("to", to); err != nil {
+		return cfg, usageError(flags, err)
+	}
+
+	return cfg, nil
+}
+
+// usageError reports the error the same way flag.Parse does for unknown flags.
+func usageError(flags *flag.FlagSet, err error) error {
+	fmt.Fprintln(flags.Output(), err)
+	flags.Usage()
+
+	return err
+}
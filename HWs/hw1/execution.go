@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+var executionTradeHeader = []string{
+	"user_id", "ticker", "time", "side", "price", "candle_time", "vs_vwap", "vs_open", "vs_close", "range_pct",
+}
+
+// fillQuality compares a fill with its candle. Distances are signed so that a positive
+// value is always a cost: paying more on a buy or getting less on a sell.
+type fillQuality struct {
+	vsVWAP   decimal.Decimal
+	vsOpen   decimal.Decimal
+	vsClose  decimal.Decimal
+	rangePct decimal.Decimal
+}
+
+var two = decimal.FromInt(2)
+
+// referencePrice is the price a fill is measured against: the VWAP of the candle, or the
+// middle of its range when the candle has no volume.
+func referencePrice(point candlePoint) (decimal.Decimal, error) {
+	if point.volume != 0 {
+		return point.vwap, nil
+	}
+
+	sum, err := point.high.CheckedAdd(point.low)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return sum.Div(two)
+}
+
+// measureFill only fails for prices so large that their differences leave the decimal range.
+func measureFill(trade userTrade, point candlePoint) (fillQuality, error) {
+	cost := func(reference decimal.Decimal) (decimal.Decimal, error) {
+		if trade.side == buySide {
+			return trade.price.CheckedSub(reference)
+		}
+
+		return reference.CheckedSub(trade.price)
+	}
+
+	reference, err := referencePrice(point)
+	if err != nil {
+		return fillQuality{}, err
+	}
+
+	var quality fillQuality
+
+	if quality.vsVWAP, err = cost(reference); err != nil {
+		return fillQuality{}, err
+	}
+
+	if quality.vsOpen, err = cost(point.open); err != nil {
+		return fillQuality{}, err
+	}
+
+	if quality.vsClose, err = cost(point.close); err != nil {
+		return fillQuality{}, err
+	}
+
+	spread, err := point.high.CheckedSub(point.low)
+	if err != nil {
+		return fillQuality{}, err
+	}
+
+	// A flat candle gives no range to place the fill in, count it as the middle.
+	if spread.IsZero() {
+		quality.rangePct = decimal.FromInt(50)
+		return quality, nil
+	}
+
+	offset, err := trade.price.CheckedSub(point.low)
+	if err != nil {
+		return fillQuality{}, err
+	}
+
+	if quality.rangePct, err = percent(offset, spread); err != nil {
+		return fillQuality{}, err
+	}
+
+	return quality, nil
+}
+
+type executionSummary struct {
+	fills    int
+	missing  int
+	vsVWAP   decimal.Decimal
+	vsOpen   decimal.Decimal
+	vsClose  decimal.Decimal
+	rangePct decimal.Decimal
+}
+
+// add leaves the summary unchanged when a total overflows.
+func (s *executionSummary) add(quality fillQuality) error {
+	vsVWAP, err := s.vsVWAP.CheckedAdd(quality.vsVWAP)
+	if err != nil {
+		return err
+	}
+
+	vsOpen, err := s.vsOpen.CheckedAdd(quality.vsOpen)
+	if err != nil {
+		return err
+	}
+
+	vsClose, err := s.vsClose.CheckedAdd(quality.vsClose)
+	if err != nil {
+		return err
+	}
+
+	rangePct, err := s.rangePct.CheckedAdd(quality.rangePct)
+	if err != nil {
+		return err
+	}
+
+	s.fills++
+	s.vsVWAP, s.vsOpen, s.vsClose, s.rangePct = vsVWAP, vsOpen, vsClose, rangePct
+
+	return nil
+}
+
+// executionStats measures every fill against its candle and rolls the results up per
+// user and ticker.
+type executionStats struct {
+	index   *candleIndex
+	summary map[positionKey]*executionSummary
+	trades  *csvStream
+}
+
+func newExecutionStats(index *candleIndex) *executionStats {
+	return &executionStats{index: index, summary: make(map[positionKey]*executionSummary)}
+}
+
+func (e *executionStats) addTrade(trade userTrade) error {
+	key := positionKey{userID: trade.userID, ticker: trade.ticker}
+
+	summary, ok := e.summary[key]
+	if !ok {
+		summary = &executionSummary{}
+		e.summary[key] = summary
+	}
+
+	point, ok := e.index.candle(trade)
+	if !ok {
+		summary.missing++
+		return nil
+	}
+
+	quality, err := measureFill(trade, point)
+	if err == nil {
+		err = summary.add(quality)
+	}
+
+	if err != nil {
+		return fmt.Errorf("execution of user %s %s at %s: %w", trade.userID, trade.ticker,
+			trade.timestamp.Format(time.RFC3339), err)
+	}
+
+	if e.trades == nil {
+		return nil
+	}
+
+	return e.trades.write([]string{
+		trade.userID,
+		trade.ticker,
+		trade.timestamp.Format(time.RFC3339),
+		trade.side.String(),
+		trade.price.String(),
+		point.timestamp.Format(time.RFC3339),
+		quality.vsVWAP.String(),
+		quality.vsOpen.String(),
+		quality.vsClose.String(),
+		quality.rangePct.StringFixed(2),
+	})
+}
+
+func (e *executionStats) close() error {
+	if e.trades == nil {
+		return nil
+	}
+
+	return e.trades.close()
+}
+
+func (e *executionStats) summaryTable() table {
+	summary := table{
+		header: []string{
+			"user_id", "ticker", "fills", "missing_candle", "avg_vs_vwap", "avg_vs_open", "avg_vs_close", "avg_range_pct",
+		},
+	}
+
+	keys := make([]positionKey, 0, len(e.summary))
+	for key := range e.summary {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(lhs, rhs int) bool {
+		if keys[lhs].userID != keys[rhs].userID {
+			return keys[lhs].userID < keys[rhs].userID
+		}
+
+		return keys[lhs].ticker < keys[rhs].ticker
+	})
+
+	for _, key := range keys {
+		stats := e.summary[key]
+		fills := decimal.FromInt(int64(stats.fills))
+
+		average := func(total decimal.Decimal) string {
+			avg, err := total.Div(fills)
+			if err != nil {
+				return ""
+			}
+
+			return avg.StringFixed(4)
+		}
+
+		summary.rows = append(summary.rows, []string{
+			key.userID,
+			key.ticker,
+			strconv.Itoa(stats.fills),
+			strconv.Itoa(stats.missing),
+			average(stats.vsVWAP),
+			average(stats.vsOpen),
+			average(stats.vsClose),
+			average(stats.rangePct),
+		})
+	}
+
+	return summary
+}
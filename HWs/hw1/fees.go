@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+// feeModel prices the commission of a trade.
+type feeModel interface {
+	// charge returns the fee of the trade and records it, e.g. to count monthly volume.
+	charge(trade userTrade) (decimal.Decimal, error)
+	// quote returns the fee the trade would cost without recording it.
+	quote(trade userTrade) decimal.Decimal
+}
+
+type noFee struct{}
+
+func (noFee) charge(userTrade) (decimal.Decimal, error) { return decimal.Zero, nil }
+
+func (noFee) quote(userTrade) decimal.Decimal { return decimal.Zero }
+
+// fixedFee charges the same amount for every trade.
+type fixedFee struct {
+	amount decimal.Decimal
+}
+
+func (f fixedFee) charge(trade userTrade) (decimal.Decimal, error) { return f.quote(trade), nil }
+
+func (f fixedFee) quote(userTrade) decimal.Decimal { return f.amount }
+
+// percentFee charges a percentage of the trade notional.
+type percentFee struct {
+	percent decimal.Decimal
+}
+
+func (f percentFee) charge(trade userTrade) (decimal.Decimal, error) { return f.quote(trade), nil }
+
+func (f percentFee) quote(trade userTrade) decimal.Decimal {
+	return percentOf(trade.notional(), f.percent)
+}
+
+// percentOf is value × percent / 100. When the product is out of range the value is
+// divided first, which only loses digits far below the fee's. With percent at most 100,
+// see checkPercent, the fee is never bigger than the value.
+func percentOf(value, percent decimal.Decimal) decimal.Decimal {
+	hundred := decimal.FromInt(100)
+
+	if product, err := value.CheckedMul(percent); err == nil {
+		fee, _ := product.Div(hundred)
+		return fee
+	}
+
+	hundredth, _ := value.Div(hundred)
+
+	return hundredth.Mul(percent)
+}
+
+// checkPercent keeps percentOf in range for any notional.
+func checkPercent(percent decimal.Decimal) error {
+	if percent.IsNegative() || percent.GreaterThan(decimal.FromInt(100)) {
+		return fmt.Errorf("percent %s is not within 0 and 100", percent)
+	}
+
+	return nil
+}
+
+type feeTier struct {
+	FromVolume decimal.Decimal `json:"from_volume"`
+	Percent    decimal.Decimal `json:"percent"`
+}
+
+// volumeKey is the volume of a user in a currency and a calendar month.
+type volumeKey struct {
+	userID   string
+	currency string
+	month    int
+}
+
+// tieredFee charges a percentage of the notional that depends on the volume the user
+// has already traded in the same calendar month. Notionals in different currencies are
+// not added up, the volume is counted per currency of the instruments.
+type tieredFee struct {
+	tiers       []feeTier
+	instruments instrumentTable
+	volumes     map[volumeKey]decimal.Decimal
+}
+
+func newTieredFee(tiers []feeTier, instruments instrumentTable) (*tieredFee, error) {
+	if len(tiers) == 0 {
+		return nil, fmt.Errorf("tiered fee needs at least one tier")
+	}
+
+	for _, tier := range tiers {
+		if err := checkPercent(tier.Percent); err != nil {
+			return nil, err
+		}
+	}
+
+	sorted := make([]feeTier, len(tiers))
+	copy(sorted, tiers)
+
+	sort.Slice(sorted, func(lhs, rhs int) bool {
+		return sorted[lhs].FromVolume.LessThan(sorted[rhs].FromVolume)
+	})
+
+	return &tieredFee{tiers: sorted, instruments: instruments, volumes: make(map[volumeKey]decimal.Decimal)}, nil
+}
+
+func (f *tieredFee) volumeKey(trade userTrade) volumeKey {
+	year, month, _ := trade.timestamp.Date()
+
+	return volumeKey{
+		userID:   trade.userID,
+		currency: f.instruments.currency(trade.ticker),
+		month:    year*12 + int(month),
+	}
+}
+
+func (f *tieredFee) rate(volume decimal.Decimal) decimal.Decimal {
+	rate := decimal.Zero
+	for _, tier := range f.tiers {
+		if volume.LessThan(tier.FromVolume) {
+			break
+		}
+
+		rate = tier.Percent
+	}
+
+	return rate
+}
+
+func (f *tieredFee) quote(trade userTrade) decimal.Decimal {
+	return percentOf(trade.notional(), f.rate(f.volumes[f.volumeKey(trade)]))
+}
+
+func (f *tieredFee) charge(trade userTrade) (decimal.Decimal, error) {
+	fee := f.quote(trade)
+
+	key := f.volumeKey(trade)
+
+	volume, err := f.volumes[key].CheckedAdd(trade.notional())
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("monthly volume of user %s in %s: %w", trade.userID, key.currency, err)
+	}
+
+	f.volumes[key] = volume
+
+	return fee, nil
+}
+
+// feeConfig is the fee config file, e.g.
+//
+//	{"model": "tiered", "tiers": [{"from_volume": 0, "percent": 0.05}, {"from_volume": 100000, "percent": 0.03}]}
+//
+// Percentages are in percent of the trade notional. Tier volumes are in the currency of
+// the instrument traded.
+type feeConfig struct {
+	Model   string          `json:"model"`
+	Fixed   decimal.Decimal `json:"fixed"`
+	Percent decimal.Decimal `json:"percent"`
+	Tiers   []feeTier       `json:"tiers"`
+}
+
+func loadFeeModel(filename string, instruments instrumentTable) (feeModel, error) {
+	if filename == "" {
+		return noFee{}, nil
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("can't read fee config: %s", err)
+	}
+
+	var cfg feeConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("can't parse fee config %s: %s", filename, err)
+	}
+
+	switch cfg.Model {
+	case "none", "":
+		return noFee{}, nil
+	case "fixed":
+		return fixedFee{amount: cfg.Fixed}, nil
+	case "percent":
+		if err := checkPercent(cfg.Percent); err != nil {
+			return nil, fmt.Errorf("fee config %s: %s", filename, err)
+		}
+
+		return percentFee{percent: cfg.Percent}, nil
+	case "tiered":
+		model, err := newTieredFee(cfg.Tiers, instruments)
+		if err != nil {
+			return nil, fmt.Errorf("fee config %s: %s", filename, err)
+		}
+
+		return model, nil
+	default:
+		return nil, fmt.Errorf("unknown fee model %q in %s, expected fixed, percent or tiered", cfg.Model, filename)
+	}
+}
+
+// chargeFees sets the fee of every trade before it gets to the ledger.
+func chargeFees(model feeModel, next tradeHandler) tradeHandler {
+	return func(trade userTrade) error {
+		var err error
+		if trade.fee, err = model.charge(trade); err != nil {
+			return err
+		}
+
+		return next(trade)
+	}
+}
+
+// netRevenue is the best possible revenue for the quantity less the fees the user would
+// pay for its two trades. Quoted after all trades are charged, a tiered fee takes the
+// tier of the user's volume over the whole month.
+func netRevenue(model feeModel, userID, ticker string, best *bestTrade, quantity int64) (decimal.Decimal, error) {
+	buy := userTrade{
+		userID: userID, ticker: ticker, timestamp: best.buyTime, side: buySide, price: best.buyPrice, quantity: quantity,
+	}
+	sell := userTrade{
+		userID: userID, ticker: ticker, timestamp: best.sellTime, side: sellSide, price: best.sellPrice, quantity: quantity,
+	}
+
+	revenue, err := best.revenue.CheckedMulInt(quantity)
+	if err == nil {
+		revenue, err = revenue.CheckedSub(model.quote(buy))
+	}
+
+	if err == nil {
+		revenue, err = revenue.CheckedSub(model.quote(sell))
+	}
+
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("max revenue of user %s in %s: %w", userID, ticker, err)
+	}
+
+	return revenue, nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+var testInstruments = instrumentTable{
+	"AAPL": {ticker: "AAPL", currency: "USD", lotSize: 1, priceStep: decimal.MustParse("0.01")},
+	"SBER": {ticker: "SBER", currency: "RUB", lotSize: 10, priceStep: decimal.MustParse("0.01")},
+}
+
+func TestPercentOf(t *testing.T) {
+	tests := map[string]struct {
+		value   decimal.Decimal
+		percent string
+		want    string
+	}{
+		"simple":           {value: decimal.MustParse("1000"), percent: "0.05", want: "0.5"},
+		"truncated":        {value: decimal.MustParse("0.01"), percent: "0.05", want: "0.000005"},
+		"below a unit":     {value: decimal.MustParse("0.000001"), percent: "0.05", want: "0"},
+		"all of it":        {value: decimal.MustParse("161.22"), percent: "100", want: "161.22"},
+		"none":             {value: decimal.MustParse("161.22"), percent: "0", want: "0"},
+		"product overflow": {value: decimal.FromUnits(9000000000000000000), percent: "50", want: "4500000000000"},
+	}
+
+	for name, tt := range tests {
+		if got := percentOf(tt.value, decimal.MustParse(tt.percent)).String(); got != tt.want {
+			t.Errorf("%s: got %s, want %s", name, got, tt.want)
+		}
+	}
+}
+
+func TestFixedAndPercentFee(t *testing.T) {
+	trade := testTrade(buySide, "161.22", 10, 0)
+
+	tests := map[string]struct {
+		model feeModel
+		want  string
+	}{
+		"none":    {model: noFee{}, want: "0"},
+		"fixed":   {model: fixedFee{amount: decimal.MustParse("1.5")}, want: "1.5"},
+		"percent": {model: percentFee{percent: decimal.MustParse("0.1")}, want: "1.6122"},
+	}
+
+	for name, tt := range tests {
+		fee, err := tt.model.charge(trade)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if fee.String() != tt.want || tt.model.quote(trade).String() != tt.want {
+			t.Errorf("%s: charged %s and quoted %s, want %s", name, fee, tt.model.quote(trade), tt.want)
+		}
+	}
+}
+
+// TestTieredFee charges trades in order, the volume counts per user, currency and month.
+func TestTieredFee(t *testing.T) {
+	model, err := newTieredFee([]feeTier{
+		{FromVolume: decimal.FromInt(1000), Percent: decimal.MustParse("0.05")},
+		{FromVolume: decimal.Zero, Percent: decimal.MustParse("0.1")},
+	}, testInstruments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trade := func(userID, ticker string, month time.Month, price string) userTrade {
+		trade := testTrade(buySide, price, 1, 0)
+		trade.userID, trade.ticker = userID, ticker
+		trade.timestamp = time.Date(2019, month, 30, 7, 0, 0, 0, time.UTC)
+
+		return trade
+	}
+
+	for i, tt := range []struct {
+		trade userTrade
+		want  string
+	}{
+		{trade: trade("1", "AAPL", time.January, "600"), want: "0.6"},
+		{trade: trade("1", "AAPL", time.January, "600"), want: "0.6"},
+		// 1200 traded this month, the next tier.
+		{trade: trade("1", "AAPL", time.January, "100"), want: "0.05"},
+		{trade: trade("1", "SBER", time.January, "100"), want: "0.1"},
+		{trade: trade("2", "AAPL", time.January, "100"), want: "0.1"},
+		{trade: trade("1", "AAPL", time.February, "100"), want: "0.1"},
+		{trade: trade("1", "AAPL", time.January, "200"), want: "0.1"},
+	} {
+		quote := model.quote(tt.trade)
+
+		fee, err := model.charge(tt.trade)
+		if err != nil {
+			t.Fatalf("trade %d: %s", i, err)
+		}
+
+		if fee.String() != tt.want || !quote.Equal(fee) {
+			t.Errorf("trade %d: quoted %s and charged %s, want %s", i, quote, fee, tt.want)
+		}
+	}
+}
+
+func TestTieredFeeOverflow(t *testing.T) {
+	model, err := newTieredFee([]feeTier{{Percent: decimal.MustParse("0.1")}}, testInstruments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trade := testTrade(buySide, "9000000000000", 1, 0)
+
+	if _, err := model.charge(trade); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := model.charge(trade); err == nil {
+		t.Error("the second trade overflows the monthly volume, got no error")
+	}
+}
+
+func TestNetRevenue(t *testing.T) {
+	best := &bestTrade{
+		maxRevenue: maxRevenue{
+			revenue:     decimal.MustParse("10"),
+			buyPrice:    decimal.MustParse("100"),
+			sellPrice:   decimal.MustParse("110"),
+			tradeWindow: tradeWindow{buyTime: testStart, sellTime: testStart.Add(time.Hour)},
+		},
+		found: true,
+	}
+
+	tests := map[string]struct {
+		model feeModel
+		want  string
+	}{
+		"no fee":  {model: noFee{}, want: "30"},
+		"fixed":   {model: fixedFee{amount: decimal.MustParse("20")}, want: "-10"},
+		"percent": {model: percentFee{percent: decimal.MustParse("1")}, want: "23.7"},
+	}
+
+	for name, tt := range tests {
+		got, err := netRevenue(tt.model, "1", "AAPL", best, 3)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if got.String() != tt.want {
+			t.Errorf("%s: got %s, want %s", name, got, tt.want)
+		}
+	}
+}
+
+func TestLoadFeeModel(t *testing.T) {
+	tests := map[string]struct {
+		want feeModel
+		err  bool
+	}{
+		`{}`:                                   {want: noFee{}},
+		`{"model": "none"}`:                    {want: noFee{}},
+		`{"model": "fixed", "fixed": 1.5}`:     {want: fixedFee{amount: decimal.MustParse("1.5")}},
+		`{"model": "percent", "percent": 0.1}`: {want: percentFee{percent: decimal.MustParse("0.1")}},
+		`{"model": "percent", "percent": 101}`: {err: true},
+		`{"model": "percent", "percent": -1}`:  {err: true},
+		`{"model": "tiered"}`:                  {err: true},
+		`{"model": "tiered", "tiers": [{"from_volume": 0, "percent": 200}]}`: {err: true},
+		`{"model": "flat"}`: {err: true},
+		`{"model": `:        {err: true},
+	}
+
+	dir := t.TempDir()
+
+	for config, tt := range tests {
+		filename := filepath.Join(dir, "fees.json")
+		if err := ioutil.WriteFile(filename, []byte(config), 0o644); err != nil { //nolint
+			t.Fatal(err)
+		}
+
+		got, err := loadFeeModel(filename, testInstruments)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: got error %v, want error %t", config, err, tt.err)
+			continue
+		}
+
+		if !tt.err && got != tt.want {
+			t.Errorf("%s: got %#v, want %#v", config, got, tt.want)
+		}
+	}
+
+	model, err := loadFeeModel("fees.json", testInstruments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tiered, ok := model.(*tieredFee); !ok || len(tiered.tiers) != 3 {
+		t.Errorf("fees.json: got %#v, want three tiers", model)
+	}
+}
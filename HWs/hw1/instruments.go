@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+type instrument struct {
+	ticker    string
+	currency  string
+	lotSize   int64
+	priceStep decimal.Decimal
+}
+
+// onStep tells whether the price is a whole number of price steps.
+func (i instrument) onStep(price decimal.Decimal) bool {
+	if i.priceStep.Sign() <= 0 {
+		return true
+	}
+
+	return price.Units()%i.priceStep.Units() == 0
+}
+
+// normalizeTicker is the form of a ticker every input is matched in: the instruments,
+// the candles, the user trades and the -tickers filter.
+func normalizeTicker(ticker string) string {
+	return strings.ToUpper(strings.TrimSpace(ticker))
+}
+
+// instrumentTable is loaded from a CSV file with ticker,currency,lot_size,price_step
+// rows. A header row is allowed.
+type instrumentTable map[string]instrument
+
+func loadInstruments(filename string) (instrumentTable, error) {
+	instruments := make(instrumentTable)
+	if filename == "" {
+		return instruments, nil
+	}
+
+	line := 0
+
+	err := readCSV(filename, func(record []string) error {
+		line++
+
+		if line == 1 && strings.EqualFold(record[0], "ticker") {
+			return nil
+		}
+
+		if len(record) < 4 {
+			return fmt.Errorf("line %d: expected ticker,currency,lot_size,price_step", line)
+		}
+
+		lotSize, err := strconv.ParseInt(record[2], 10, 64)
+		if err != nil || lotSize <= 0 {
+			return fmt.Errorf("line %d: bad lot size %q", line, record[2])
+		}
+
+		priceStep, err := decimal.Parse(record[3])
+		if err != nil || priceStep.IsNegative() {
+			return fmt.Errorf("line %d: bad price step %q", line, record[3])
+		}
+
+		ticker := normalizeTicker(record[0])
+		instruments[ticker] = instrument{
+			ticker:    ticker,
+			currency:  strings.ToUpper(record[1]),
+			lotSize:   lotSize,
+			priceStep: priceStep,
+		}
+
+		return nil
+	})
+
+	return instruments, err
+}
+
+func (t instrumentTable) currency(ticker string) string {
+	return t[ticker].currency
+}
+
+// lotSize is one for instruments missing from the table.
+func (t instrumentTable) lotSize(ticker string) int64 {
+	if info, ok := t[ticker]; ok {
+		return info.lotSize
+	}
+
+	return 1
+}
+
+type fxRate struct {
+	timestamp time.Time
+	rate      decimal.Decimal
+}
+
+type currencyPair struct {
+	base  string
+	quote string
+}
+
+// fxRates is a time series of exchange rates loaded from a CSV file with
+// base,quote,timestamp,rate rows, where 1 base costs rate quote. A header row is allowed.
+type fxRates struct {
+	series map[currencyPair][]fxRate
+}
+
+func loadFXRates(filename string) (*fxRates, error) {
+	rates := &fxRates{series: make(map[currencyPair][]fxRate)}
+	if filename == "" {
+		return rates, nil
+	}
+
+	line := 0
+
+	err := readCSV(filename, func(record []string) error {
+		line++
+
+		if line == 1 && strings.EqualFold(record[0], "base") {
+			return nil
+		}
+
+		if len(record) < 4 {
+			return fmt.Errorf("line %d: expected base,quote,timestamp,rate", line)
+		}
+
+		timestamp, err := time.Parse(time.RFC3339, record[2])
+		if err != nil {
+			return fmt.Errorf("line %d: bad timestamp %q", line, record[2])
+		}
+
+		rate, err := decimal.Parse(record[3])
+		if err != nil || rate.Sign() <= 0 {
+			return fmt.Errorf("line %d: bad rate %q", line, record[3])
+		}
+
+		pair := currencyPair{base: strings.ToUpper(record[0]), quote: strings.ToUpper(record[1])}
+		rates.series[pair] = append(rates.series[pair], fxRate{timestamp: timestamp, rate: rate})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, series := range rates.series {
+		sort.SliceStable(series, func(lhs, rhs int) bool {
+			return series[lhs].timestamp.Before(series[rhs].timestamp)
+		})
+	}
+
+	return rates, nil
+}
+
+// rateAt returns the last known rate of the pair at the given time.
+func (r *fxRates) rateAt(pair currencyPair, at time.Time) (decimal.Decimal, bool) {
+	series := r.series[pair]
+
+	i := sort.Search(len(series), func(i int) bool {
+		return series[i].timestamp.After(at)
+	})
+	if i == 0 {
+		return decimal.Zero, false
+	}
+
+	return series[i-1].rate, true
+}
+
+func (r *fxRates) convert(amount decimal.Decimal, from, to string, at time.Time) (decimal.Decimal, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	var (
+		converted decimal.Decimal
+		err       error
+	)
+
+	if rate, ok := r.rateAt(currencyPair{base: from, quote: to}, at); ok {
+		converted, err = amount.CheckedMul(rate)
+	} else if rate, ok := r.rateAt(currencyPair{base: to, quote: from}, at); ok {
+		converted, err = amount.Div(rate)
+	} else {
+		return decimal.Zero, fmt.Errorf("no %s/%s rate at %s", from, to, at.Format(time.RFC3339))
+	}
+
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("can't convert %s %s to %s: %w", amount, from, to, err)
+	}
+
+	return converted, nil
+}
+
+// reportingCurrency converts amounts of any instrument into one currency.
+type reportingCurrency struct {
+	code        string
+	instruments instrumentTable
+	rates       *fxRates
+}
+
+func (c *reportingCurrency) convert(amount decimal.Decimal, ticker string, at time.Time) (decimal.Decimal, error) {
+	if amount.IsZero() {
+		return amount, nil
+	}
+
+	currency := c.instruments.currency(ticker)
+	if currency == "" {
+		return decimal.Zero, fmt.Errorf("no currency for %s in the instruments table", ticker)
+	}
+
+	return c.rates.convert(amount, currency, c.code, at)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+func writeTestFile(t *testing.T, name, data string) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, []byte(data), 0o644); err != nil { //nolint
+		t.Fatal(err)
+	}
+
+	return filename
+}
+
+func TestLoadInstruments(t *testing.T) {
+	tests := map[string]struct {
+		data string
+		want instrumentTable
+		err  string
+	}{
+		"header": {
+			data: "ticker,currency,lot_size,price_step\nAAPL,USD,1,0.01\n",
+			want: instrumentTable{"AAPL": {ticker: "AAPL", currency: "USD", lotSize: 1, priceStep: decimal.MustParse("0.01")}},
+		},
+		"normalized": {
+			data: " sber ,rub,10,0.01\n",
+			want: instrumentTable{"SBER": {ticker: "SBER", currency: "RUB", lotSize: 10, priceStep: decimal.MustParse("0.01")}},
+		},
+		"short row":     {data: "AAPL,USD,1\n", err: "line 1: expected"},
+		"bad lot size":  {data: "AAPL,USD,0,0.01\n", err: "line 1: bad lot size"},
+		"bad step":      {data: "AAPL,USD,1,-0.01\n", err: "line 1: bad price step"},
+		"bad 2nd line":  {data: "AAPL,USD,1,0.01\nAMZN,USD,x,0.01\n", err: "line 2: bad lot size"},
+		"empty is fine": {want: instrumentTable{}},
+	}
+
+	for name, tt := range tests {
+		got, err := loadInstruments(writeTestFile(t, "instruments.csv", tt.data))
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", name, err, tt.err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", name, got, tt.want)
+			continue
+		}
+
+		for ticker, want := range tt.want {
+			if got[ticker] != want {
+				t.Errorf("%s: %s is %+v, want %+v", name, ticker, got[ticker], want)
+			}
+		}
+	}
+}
+
+func TestInstrumentLookups(t *testing.T) {
+	if got := testInstruments.lotSize("SBER"); got != 10 {
+		t.Errorf("SBER lot size %d, want 10", got)
+	}
+
+	if got := testInstruments.lotSize("GAZP"); got != 1 {
+		t.Errorf("unlisted lot size %d, want 1", got)
+	}
+
+	if got := testInstruments.currency("GAZP"); got != "" {
+		t.Errorf("unlisted currency %q, want none", got)
+	}
+
+	step := testInstruments["AAPL"]
+	for price, want := range map[string]bool{"161.22": true, "161.225": false, "0": true} {
+		if got := step.onStep(decimal.MustParse(price)); got != want {
+			t.Errorf("%s on a 0.01 step: got %t, want %t", price, got, want)
+		}
+	}
+}
+
+// testRates are USD/RUB rates at midnight of January 30 and 31, listed out of order.
+func testRates(t *testing.T) *fxRates {
+	t.Helper()
+
+	rates, err := loadFXRates(writeTestFile(t, "fx.csv", "base,quote,timestamp,rate\n"+
+		"usd,rub,2019-01-31T00:00:00Z,65.88\n"+
+		"USD,RUB,2019-01-30T00:00:00Z,66\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rates
+}
+
+func TestRateAt(t *testing.T) {
+	rates := testRates(t)
+	day := time.Date(2019, 1, 30, 0, 0, 0, 0, time.UTC)
+	pair := currencyPair{base: "USD", quote: "RUB"}
+
+	tests := map[string]struct {
+		pair currencyPair
+		at   time.Time
+		want string
+	}{
+		"before the first rate": {pair: pair, at: day.Add(-time.Second)},
+		"at the first rate":     {pair: pair, at: day, want: "66"},
+		"between the rates":     {pair: pair, at: day.Add(12 * time.Hour), want: "66"},
+		"at the second rate":    {pair: pair, at: day.Add(24 * time.Hour), want: "65.88"},
+		"after the last rate":   {pair: pair, at: day.Add(30 * 24 * time.Hour), want: "65.88"},
+		"unknown pair":          {pair: currencyPair{base: "EUR", quote: "RUB"}, at: day},
+	}
+
+	for name, tt := range tests {
+		rate, ok := rates.rateAt(tt.pair, tt.at)
+		if ok != (tt.want != "") || ok && rate.String() != tt.want {
+			t.Errorf("%s: got %s %t, want %s", name, rate, ok, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates := testRates(t)
+	at := time.Date(2019, 1, 30, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		amount string
+		from   string
+		to     string
+		at     time.Time
+		want   string
+		err    string
+	}{
+		"same currency": {amount: "10", from: "RUB", to: "RUB", want: "10"},
+		"direct rate":   {amount: "10", from: "USD", to: "RUB", at: at, want: "660"},
+		"inverse rate":  {amount: "33", from: "RUB", to: "USD", at: at, want: "0.5"},
+		"truncated":     {amount: "1", from: "RUB", to: "USD", at: at, want: "0.015151"},
+		"negative":      {amount: "-10", from: "USD", to: "RUB", at: at, want: "-660"},
+		"no rate yet":   {amount: "10", from: "USD", to: "RUB", at: at.Add(-24 * time.Hour), err: "no USD/RUB rate"},
+		"no pair":       {amount: "10", from: "EUR", to: "RUB", at: at, err: "no EUR/RUB rate"},
+		"overflow":      {amount: "9000000000000", from: "USD", to: "RUB", at: at, err: decimal.ErrRange.Error()},
+	}
+
+	for name, tt := range tests {
+		got, err := rates.convert(decimal.MustParse(tt.amount), tt.from, tt.to, tt.at)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", name, err, tt.err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if got.String() != tt.want {
+			t.Errorf("%s: got %s, want %s", name, got, tt.want)
+		}
+	}
+}
+
+func TestReportingCurrency(t *testing.T) {
+	reporting := &reportingCurrency{code: "RUB", instruments: testInstruments, rates: testRates(t)}
+	at := time.Date(2019, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	got, err := reporting.convert(decimal.FromInt(2), "AAPL", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.String() != "131.76" {
+		t.Errorf("2 USD of AAPL: got %s RUB, want 131.76", got)
+	}
+
+	if _, err := reporting.convert(decimal.FromInt(2), "GAZP", at); err == nil {
+		t.Error("GAZP has no currency, got no error")
+	}
+
+	// A zero amount needs no rate.
+	if got, err := reporting.convert(decimal.Zero, "GAZP", at); err != nil || !got.IsZero() {
+		t.Errorf("zero of GAZP: got %s, %v", got, err)
+	}
+}
+
+// TestLedgerReportingCurrency converts the realized PnL and the fees at the time of the
+// trades that close and pay them.
+func TestLedgerReportingCurrency(t *testing.T) {
+	l := newLedger(&reportingCurrency{code: "RUB", instruments: testInstruments, rates: testRates(t)})
+
+	buy := testTrade(buySide, "100", 1, 0) // January 30, at 66
+	buy.fee = decimal.FromInt(1)
+
+	sell := testTrade(sellSide, "110", 1, 24*60) // January 31, at 65.88
+	sell.fee = decimal.FromInt(1)
+
+	for _, trade := range []userTrade{buy, sell} {
+		if err := l.add(trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pos := l.position("1", "AAPL")
+	if pos.convertedRealized.String() != "658.8" || pos.convertedFees.String() != "131.88" {
+		t.Errorf("got realized %s and fees %s, want 658.8 and 131.88", pos.convertedRealized, pos.convertedFees)
+	}
+}
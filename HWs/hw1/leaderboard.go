@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+// userScore sums up a user's results across all tickers of a currency.
+type userScore struct {
+	userID     string
+	currency   string
+	pnl        decimal.Decimal
+	maxRevenue decimal.Decimal
+	roundTrips int
+	wins       int
+	holding    time.Duration
+}
+
+// efficiency is the share of the max possible revenue the user managed to get. It is
+// not defined when the fees leave no max revenue, i.e. it is zero or negative.
+func (s userScore) efficiency() (decimal.Decimal, bool) {
+	if s.maxRevenue.Sign() <= 0 {
+		return decimal.Zero, false
+	}
+
+	ratio, err := s.pnl.Div(s.maxRevenue)
+	if err != nil {
+		// Only a ratio beyond the decimal range fails, it ranks at the limit.
+		if s.pnl.IsNegative() {
+			return decimal.FromUnits(math.MinInt64), true
+		}
+
+		return decimal.FromUnits(math.MaxInt64), true
+	}
+
+	return ratio, true
+}
+
+func (s userScore) hitRate() decimal.Decimal {
+	rate, err := decimal.FromInt(int64(s.wins)).Div(decimal.FromInt(int64(s.roundTrips)))
+	if err != nil {
+		return decimal.Zero
+	}
+
+	return rate
+}
+
+func (s userScore) averageHolding() time.Duration {
+	if s.roundTrips == 0 {
+		return 0
+	}
+
+	return s.holding / time.Duration(s.roundTrips)
+}
+
+// scoreUsers ranks users by efficiency, see rankUsers. Both PnL and max revenue are net
+// of fees. Tickers without a max revenue are left out as there is nothing to compare
+// with. Amounts of different currencies are not added up: users are ranked per
+// currency, or in the reporting currency if there is one, with the max revenue
+// converted at the time of its sell.
+func scoreUsers(usersLedger *ledger, maxRevenues map[string]*bestTrade, fees feeModel,
+	instruments instrumentTable) ([]userScore, error) {
+	scores := make(map[positionKey]*userScore)
+
+	for key, pos := range usersLedger.positions {
+		best, ok := maxRevenues[key.ticker]
+		if !ok || !best.found {
+			continue
+		}
+
+		currency := instruments.currency(key.ticker)
+
+		pnl, err := pos.netPnL()
+		if err != nil {
+			return nil, fmt.Errorf("user %s %s: net PnL: %w", key.userID, key.ticker, err)
+		}
+
+		maxRevenue, err := netRevenue(fees, key.userID, key.ticker, best, pos.size())
+		if err != nil {
+			return nil, err
+		}
+
+		if reporting := usersLedger.reporting; reporting != nil {
+			currency = reporting.code
+
+			if pnl, err = pos.convertedRealized.CheckedSub(pos.convertedFees); err != nil {
+				return nil, fmt.Errorf("user %s %s: net PnL in %s: %w", key.userID, key.ticker, currency, err)
+			}
+
+			if maxRevenue, err = reporting.convert(maxRevenue, key.ticker, best.sellTime); err != nil {
+				return nil, err
+			}
+		}
+
+		scoreKey := positionKey{userID: key.userID, ticker: currency}
+
+		score, ok := scores[scoreKey]
+		if !ok {
+			score = &userScore{userID: key.userID, currency: currency}
+			scores[scoreKey] = score
+		}
+
+		if score.pnl, err = score.pnl.CheckedAdd(pnl); err != nil {
+			return nil, fmt.Errorf("user %s: PnL in %s: %w", key.userID, currency, err)
+		}
+
+		if score.maxRevenue, err = score.maxRevenue.CheckedAdd(maxRevenue); err != nil {
+			return nil, fmt.Errorf("user %s: max revenue in %s: %w", key.userID, currency, err)
+		}
+
+		score.roundTrips += pos.roundTrips
+		score.wins += pos.wins
+		score.holding += pos.holding
+	}
+
+	ranking := make([]userScore, 0, len(scores))
+	for _, score := range scores {
+		ranking = append(ranking, *score)
+	}
+
+	rankUsers(ranking)
+
+	return ranking, nil
+}
+
+// rankUsers sorts the scores by currency and then by efficiency, best first. Users with
+// no max revenue to get come last.
+func rankUsers(ranking []userScore) {
+	sort.Slice(ranking, func(lhs, rhs int) bool {
+		if ranking[lhs].currency != ranking[rhs].currency {
+			return ranking[lhs].currency < ranking[rhs].currency
+		}
+
+		lhsEfficiency, lhsOK := ranking[lhs].efficiency()
+		rhsEfficiency, rhsOK := ranking[rhs].efficiency()
+
+		if lhsOK != rhsOK {
+			return lhsOK
+		}
+
+		if cmp := lhsEfficiency.Cmp(rhsEfficiency); cmp != 0 {
+			return cmp > 0
+		}
+
+		return ranking[lhs].userID < ranking[rhs].userID
+	})
+}
+
+// leaderboardTable keeps the top and bottom users of the ranking of every currency, all
+// of them when both limits are zero.
+func leaderboardTable(ranking []userScore, top, bottom int) table {
+	leaderboard := table{
+		header: []string{
+			"currency", "rank", "user_id", "pnl", "max_revenue", "efficiency", "round_trips", "hit_rate", "avg_holding",
+		},
+	}
+
+	for start := 0; start < len(ranking); {
+		end := start + 1
+		for end < len(ranking) && ranking[end].currency == ranking[start].currency {
+			end++
+		}
+
+		leaderboard.rows = append(leaderboard.rows, leaderboardRows(ranking[start:end], top, bottom)...)
+		start = end
+	}
+
+	return leaderboard
+}
+
+func leaderboardRows(ranking []userScore, top, bottom int) [][]string {
+	include := func(rank int) bool {
+		if top == 0 && bottom == 0 {
+			return true
+		}
+
+		return rank < top || rank >= len(ranking)-bottom
+	}
+
+	var rows [][]string
+
+	for i, score := range ranking {
+		if !include(i) {
+			continue
+		}
+
+		efficiency := ""
+		if ratio, ok := score.efficiency(); ok {
+			efficiency = ratio.StringFixed(4)
+		}
+
+		rows = append(rows, []string{
+			score.currency,
+			strconv.Itoa(i + 1),
+			score.userID,
+			score.pnl.String(),
+			score.maxRevenue.String(),
+			efficiency,
+			strconv.Itoa(score.roundTrips),
+			score.hitRate().StringFixed(4),
+			score.averageHolding().Truncate(time.Second).String(),
+		})
+	}
+
+	return rows
+}
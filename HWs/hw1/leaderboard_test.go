@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+func TestEfficiency(t *testing.T) {
+	tests := map[string]struct {
+		pnl        string
+		maxRevenue string
+		want       string
+		ok         bool
+	}{
+		"share":              {pnl: "25", maxRevenue: "100", want: "0.25", ok: true},
+		"loss":               {pnl: "-50", maxRevenue: "100", want: "-0.5", ok: true},
+		"above max":          {pnl: "150", maxRevenue: "100", want: "1.5", ok: true},
+		"no max revenue":     {pnl: "10", maxRevenue: "0"},
+		"fees above revenue": {pnl: "-10", maxRevenue: "-5"},
+		"loss, fees above":   {pnl: "-20", maxRevenue: "-40"},
+		"out of range":       {pnl: "9000000000", maxRevenue: "0.000001", want: "9223372036854.775807", ok: true},
+		"out of range loss":  {pnl: "-9000000000", maxRevenue: "0.000001", want: "-9223372036854.775808", ok: true},
+	}
+
+	for name, tt := range tests {
+		score := userScore{pnl: decimal.MustParse(tt.pnl), maxRevenue: decimal.MustParse(tt.maxRevenue)}
+
+		got, ok := score.efficiency()
+		if ok != tt.ok {
+			t.Errorf("%s: got defined %t, want %t", name, ok, tt.ok)
+			continue
+		}
+
+		if ok && got.String() != tt.want {
+			t.Errorf("%s: got %s, want %s", name, got, tt.want)
+		}
+	}
+}
+
+func TestRankUsers(t *testing.T) {
+	score := func(userID, currency, pnl, maxRevenue string) userScore {
+		return userScore{
+			userID:     userID,
+			currency:   currency,
+			pnl:        decimal.MustParse(pnl),
+			maxRevenue: decimal.MustParse(maxRevenue),
+		}
+	}
+
+	ranking := []userScore{
+		score("1", "USD", "10", "100"),
+		score("2", "USD", "-30", "-10"), // a negative max revenue must not make a loss look good
+		score("3", "RUB", "5", "10"),
+		score("4", "USD", "50", "100"),
+		score("5", "USD", "-20", "100"),
+		score("6", "USD", "0", "0"),
+		score("7", "USD", "10", "100"),
+	}
+
+	rankUsers(ranking)
+
+	var got []string
+	for _, s := range ranking {
+		got = append(got, s.currency+":"+s.userID)
+	}
+
+	want := "RUB:3 USD:4 USD:1 USD:7 USD:5 USD:2 USD:6"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %s, want %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestLeaderboardTable(t *testing.T) {
+	ranking := make([]userScore, 0, 6)
+	for _, user := range []struct {
+		userID     string
+		currency   string
+		maxRevenue int64
+	}{
+		{"1", "RUB", 100}, {"2", "RUB", 100}, {"3", "RUB", 0},
+		{"4", "USD", 100}, {"5", "USD", 100}, {"6", "USD", 100},
+	} {
+		ranking = append(ranking, userScore{
+			userID:     user.userID,
+			currency:   user.currency,
+			pnl:        decimal.FromInt(10),
+			maxRevenue: decimal.FromInt(user.maxRevenue),
+		})
+	}
+
+	tests := map[string]struct {
+		top    int
+		bottom int
+		want   []string
+	}{
+		"all": {
+			want: []string{
+				"RUB,1,1,0.1000", "RUB,2,2,0.1000", "RUB,3,3,", "USD,1,4,0.1000", "USD,2,5,0.1000", "USD,3,6,0.1000",
+			},
+		},
+		"top":        {top: 1, want: []string{"RUB,1,1,0.1000", "USD,1,4,0.1000"}},
+		"bottom":     {bottom: 1, want: []string{"RUB,3,3,", "USD,3,6,0.1000"}},
+		"top bottom": {top: 1, bottom: 1, want: []string{"RUB,1,1,0.1000", "RUB,3,3,", "USD,1,4,0.1000", "USD,3,6,0.1000"}},
+		"overlap": {
+			top: 2, bottom: 2,
+			want: []string{
+				"RUB,1,1,0.1000", "RUB,2,2,0.1000", "RUB,3,3,", "USD,1,4,0.1000", "USD,2,5,0.1000", "USD,3,6,0.1000",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		leaderboard := leaderboardTable(ranking, tt.top, tt.bottom)
+
+		var got []string
+		for _, row := range leaderboard.rows {
+			// currency, rank, user_id and efficiency
+			got = append(got, strings.Join([]string{row[0], row[1], row[2], row[5]}, ","))
+		}
+
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: got %v, want %v", name, got, tt.want)
+		}
+	}
+}
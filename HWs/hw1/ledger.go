@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+type tradeSide int
+
+const (
+	buySide tradeSide = iota
+	sellSide
+)
+
+func (s tradeSide) String() string {
+	if s == buySide {
+		return "buy"
+	}
+
+	return "sell"
+}
+
+type userTrade struct {
+	userID    string
+	timestamp time.Time
+	ticker    string
+	side      tradeSide
+	price     decimal.Decimal
+	quantity  int64
+	fee       decimal.Decimal
+}
+
+// notional is in range, newUserTrade rejects trades whose notional is not.
+func (t userTrade) notional() decimal.Decimal {
+	return t.price.MulInt(t.quantity)
+}
+
+// roundTrip is a quantity matched between two opposite trades. The opening trade is
+// a buy for a long position and a sell for a short one.
+type roundTrip struct {
+	open     userTrade
+	close    userTrade
+	quantity int64
+}
+
+// pnl is in range as prices are not negative: it is at most the notional of one of the
+// trades.
+func (r roundTrip) pnl() decimal.Decimal {
+	if r.open.side == buySide {
+		return r.close.price.Sub(r.open.price).MulInt(r.quantity)
+	}
+
+	return r.open.price.Sub(r.close.price).MulInt(r.quantity)
+}
+
+func (r roundTrip) holding() time.Duration {
+	return r.close.timestamp.Sub(r.open.timestamp)
+}
+
+// position is the ledger of a single user in a single ticker. Only the lots that are
+// still open are kept, closed round trips are folded into the totals.
+type position struct {
+	open       []userTrade
+	bought     int64
+	sold       int64
+	realized   decimal.Decimal
+	fees       decimal.Decimal
+	roundTrips int
+	wins       int
+	holding    time.Duration
+
+	// Realized PnL and fees in the reporting currency, if there is one.
+	convertedRealized decimal.Decimal
+	convertedFees     decimal.Decimal
+}
+
+// add books the trade and returns the PnL of the round trips it closes, if any. A trade
+// bigger than the opposite open lots closes them all and opens a position with the rest.
+// The totals are checked for overflow, a failed add leaves the position unusable.
+func (p *position) add(trade userTrade) (decimal.Decimal, bool, error) {
+	var err error
+
+	if p.fees, err = p.fees.CheckedAdd(trade.fee); err != nil {
+		return decimal.Zero, false, fmt.Errorf("fees: %w", err)
+	}
+
+	if trade.side == buySide {
+		p.bought += trade.quantity
+	} else {
+		p.sold += trade.quantity
+	}
+
+	realized, closed := decimal.Zero, false
+	remaining := trade.quantity
+
+	for remaining > 0 && len(p.open) > 0 && p.open[0].side != trade.side {
+		lot := &p.open[0]
+
+		matched := lot.quantity
+		if remaining < matched {
+			matched = remaining
+		}
+
+		trip := roundTrip{open: *lot, close: trade, quantity: matched}
+		pnl := trip.pnl()
+		closed = true
+
+		if realized, err = realized.CheckedAdd(pnl); err != nil {
+			return decimal.Zero, false, fmt.Errorf("realized PnL: %w", err)
+		}
+
+		if p.realized, err = p.realized.CheckedAdd(pnl); err != nil {
+			return decimal.Zero, false, fmt.Errorf("realized PnL: %w", err)
+		}
+		p.roundTrips++
+		p.holding += trip.holding()
+
+		if pnl.Sign() > 0 {
+			p.wins++
+		}
+
+		lot.quantity -= matched
+		remaining -= matched
+
+		if lot.quantity == 0 {
+			p.open[0] = userTrade{}
+			p.open = p.open[1:]
+		}
+	}
+
+	if remaining > 0 {
+		rest := trade
+		rest.quantity = remaining
+		p.open = append(p.open, rest)
+	}
+
+	return realized, closed, nil
+}
+
+// size is the quantity the user could have bought and sold, used to scale the max
+// possible revenue.
+func (p *position) size() int64 {
+	if p.bought > p.sold {
+		return p.bought
+	}
+
+	return p.sold
+}
+
+func (p *position) realizedPnL() decimal.Decimal {
+	return p.realized
+}
+
+// netPnL is the realized PnL less the fees of all trades, including still open ones.
+func (p *position) netPnL() (decimal.Decimal, error) {
+	return p.realized.CheckedSub(p.fees)
+}
+
+type positionKey struct {
+	userID string
+	ticker string
+}
+
+// ledger matches buys against sells FIFO per user and ticker as trades are read.
+// With a reporting currency, PnL and fees are also converted at the time they occur.
+type ledger struct {
+	positions map[positionKey]*position
+	reporting *reportingCurrency
+}
+
+func newLedger(reporting *reportingCurrency) *ledger {
+	return &ledger{positions: make(map[positionKey]*position), reporting: reporting}
+}
+
+func (l *ledger) add(trade userTrade) error {
+	key := positionKey{userID: trade.userID, ticker: trade.ticker}
+
+	pos, ok := l.positions[key]
+	if !ok {
+		pos = &position{}
+		l.positions[key] = pos
+	}
+
+	pnl, closed, err := pos.add(trade)
+	if err != nil {
+		return fmt.Errorf("user %s %s: %w", trade.userID, trade.ticker, err)
+	}
+
+	if l.reporting == nil {
+		return nil
+	}
+
+	fee, err := l.reporting.convert(trade.fee, trade.ticker, trade.timestamp)
+	if err != nil {
+		return err
+	}
+
+	if pos.convertedFees, err = pos.convertedFees.CheckedAdd(fee); err != nil {
+		return fmt.Errorf("user %s %s: fees in %s: %w", trade.userID, trade.ticker, l.reporting.code, err)
+	}
+
+	if closed {
+		if pnl, err = l.reporting.convert(pnl, trade.ticker, trade.timestamp); err != nil {
+			return err
+		}
+
+		if pos.convertedRealized, err = pos.convertedRealized.CheckedAdd(pnl); err != nil {
+			return fmt.Errorf("user %s %s: realized PnL in %s: %w", trade.userID, trade.ticker, l.reporting.code, err)
+		}
+	}
+
+	return nil
+}
+
+func (l *ledger) tickers() []string {
+	seen := make(map[string]struct{})
+	for key := range l.positions {
+		seen[key.ticker] = struct{}{}
+	}
+
+	tickers := make([]string, 0, len(seen))
+	for ticker := range seen {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	return tickers
+}
+
+func (l *ledger) users(ticker string) []string {
+	var users []string
+	for key := range l.positions {
+		if key.ticker == ticker {
+			users = append(users, key.userID)
+		}
+	}
+	sort.Strings(users)
+
+	return users
+}
+
+func (l *ledger) position(userID, ticker string) *position {
+	return l.positions[positionKey{userID: userID, ticker: ticker}]
+}
+
+func (l *ledger) openTrades() []userTrade {
+	var trades []userTrade
+	for _, pos := range l.positions {
+		trades = append(trades, pos.open...)
+	}
+
+	sort.Slice(trades, func(lhs, rhs int) bool {
+		if trades[lhs].userID != trades[rhs].userID {
+			return trades[lhs].userID < trades[rhs].userID
+		}
+		if trades[lhs].ticker != trades[rhs].ticker {
+			return trades[lhs].ticker < trades[rhs].ticker
+		}
+
+		return trades[lhs].timestamp.Before(trades[rhs].timestamp)
+	})
+
+	return trades
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+var testStart = time.Date(2019, 1, 30, 7, 0, 0, 0, time.UTC)
+
+// testTrade is a trade of user 1 in AAPL, minutes after testStart.
+func testTrade(side tradeSide, price string, quantity int64, minutes int) userTrade {
+	return userTrade{
+		userID:    "1",
+		timestamp: testStart.Add(time.Duration(minutes) * time.Minute),
+		ticker:    "AAPL",
+		side:      side,
+		price:     decimal.MustParse(price),
+		quantity:  quantity,
+	}
+}
+
+// openLots formats the open lots as side quantity@price.
+func openLots(trades []userTrade) string {
+	lots := make([]string, len(trades))
+	for i, trade := range trades {
+		lots[i] = fmt.Sprintf("%s %d@%s", trade.side, trade.quantity, trade.price)
+	}
+
+	return strings.Join(lots, ", ")
+}
+
+func TestPositionAdd(t *testing.T) {
+	tests := map[string]struct {
+		trades     []userTrade
+		realized   string
+		lastPnL    string
+		closed     bool
+		roundTrips int
+		wins       int
+		holding    time.Duration
+		open       string
+		size       int64
+	}{
+		"open long": {
+			trades:   []userTrade{testTrade(buySide, "100", 10, 0)},
+			realized: "0", lastPnL: "0", open: "buy 10@100", size: 10,
+		},
+		"long round trip": {
+			trades:   []userTrade{testTrade(buySide, "100", 10, 0), testTrade(sellSide, "110.5", 10, 30)},
+			realized: "105", lastPnL: "105", closed: true, roundTrips: 1, wins: 1, holding: 30 * time.Minute, size: 10,
+		},
+		"short round trip": {
+			trades:   []userTrade{testTrade(sellSide, "100", 5, 0), testTrade(buySide, "90", 5, 10)},
+			realized: "50", lastPnL: "50", closed: true, roundTrips: 1, wins: 1, holding: 10 * time.Minute, size: 5,
+		},
+		"losing round trip": {
+			trades:   []userTrade{testTrade(buySide, "100", 2, 0), testTrade(sellSide, "99", 2, 5)},
+			realized: "-2", lastPnL: "-2", closed: true, roundTrips: 1, holding: 5 * time.Minute, size: 2,
+		},
+		"partial close": {
+			trades:   []userTrade{testTrade(buySide, "100", 10, 0), testTrade(sellSide, "110", 4, 5)},
+			realized: "40", lastPnL: "40", closed: true, roundTrips: 1, wins: 1, holding: 5 * time.Minute,
+			open: "buy 6@100", size: 10,
+		},
+		"fifo across lots": {
+			trades: []userTrade{
+				testTrade(buySide, "100", 5, 0),
+				testTrade(buySide, "120", 5, 10),
+				testTrade(sellSide, "110", 7, 20),
+			},
+			// 5 × 10 from the first lot, 2 × -10 from the second.
+			realized: "30", lastPnL: "30", closed: true, roundTrips: 2, wins: 1, holding: 30 * time.Minute,
+			open: "buy 3@120", size: 10,
+		},
+		"same side adds a lot": {
+			trades:   []userTrade{testTrade(buySide, "100", 5, 0), testTrade(buySide, "101", 5, 1)},
+			realized: "0", lastPnL: "0", open: "buy 5@100, buy 5@101", size: 10,
+		},
+		"reversal": {
+			trades:   []userTrade{testTrade(buySide, "100", 5, 0), testTrade(sellSide, "90", 8, 15)},
+			realized: "-50", lastPnL: "-50", closed: true, roundTrips: 1, holding: 15 * time.Minute,
+			open: "sell 3@90", size: 8,
+		},
+		"close after reversal": {
+			trades: []userTrade{
+				testTrade(buySide, "100", 5, 0),
+				testTrade(sellSide, "90", 8, 15),
+				testTrade(buySide, "80", 3, 20),
+			},
+			realized: "-20", lastPnL: "30", closed: true, roundTrips: 2, wins: 1, holding: 20 * time.Minute, size: 8,
+		},
+	}
+
+	for name, tt := range tests {
+		var (
+			pos    position
+			pnl    decimal.Decimal
+			closed bool
+			err    error
+		)
+
+		for _, trade := range tt.trades {
+			if pnl, closed, err = pos.add(trade); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+
+		if got := pos.realizedPnL().String(); got != tt.realized {
+			t.Errorf("%s: realized %s, want %s", name, got, tt.realized)
+		}
+
+		if pnl.String() != tt.lastPnL || closed != tt.closed {
+			t.Errorf("%s: last trade closed %t with %s, want %t with %s", name, closed, pnl, tt.closed, tt.lastPnL)
+		}
+
+		if pos.roundTrips != tt.roundTrips || pos.wins != tt.wins || pos.holding != tt.holding {
+			t.Errorf("%s: %d round trips, %d wins, %s holding, want %d, %d, %s", name,
+				pos.roundTrips, pos.wins, pos.holding, tt.roundTrips, tt.wins, tt.holding)
+		}
+
+		if got := openLots(pos.open); got != tt.open {
+			t.Errorf("%s: open %q, want %q", name, got, tt.open)
+		}
+
+		if got := pos.size(); got != tt.size {
+			t.Errorf("%s: size %d, want %d", name, got, tt.size)
+		}
+	}
+}
+
+func TestPositionNetPnL(t *testing.T) {
+	buy := testTrade(buySide, "100", 10, 0)
+	buy.fee = decimal.MustParse("1.5")
+
+	sell := testTrade(sellSide, "101", 4, 1)
+	sell.fee = decimal.MustParse("0.5")
+
+	var pos position
+	for _, trade := range []userTrade{buy, sell} {
+		if _, _, err := pos.add(trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The fees of the still open lots count too.
+	net, err := pos.netPnL()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if net.String() != "2" {
+		t.Errorf("got net PnL %s, want 2", net)
+	}
+}
+
+func TestPositionOverflow(t *testing.T) {
+	// Each round trip gains 9e12, two of them overflow the realized PnL.
+	trades := []userTrade{
+		testTrade(buySide, "0.000001", 1, 0),
+		testTrade(sellSide, "9000000000000", 1, 1),
+		testTrade(buySide, "0.000001", 1, 2),
+		testTrade(sellSide, "9000000000000", 1, 3),
+	}
+
+	var pos position
+
+	var err error
+	for _, trade := range trades {
+		if _, _, err = pos.add(trade); err != nil {
+			break
+		}
+	}
+
+	if !errors.Is(err, decimal.ErrRange) {
+		t.Errorf("got %v, want %v", err, decimal.ErrRange)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	l := newLedger(nil)
+
+	trades := []userTrade{
+		testTrade(buySide, "100", 2, 0),
+		testTrade(sellSide, "110", 1, 1),
+	}
+
+	other := testTrade(buySide, "213", 1, 2)
+	other.userID, other.ticker = "2", "SBER"
+	trades = append(trades, other)
+
+	for _, trade := range trades {
+		if err := l.add(trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := strings.Join(l.tickers(), ","); got != "AAPL,SBER" {
+		t.Errorf("tickers %s, want AAPL,SBER", got)
+	}
+
+	if got := l.position("1", "AAPL").realizedPnL().String(); got != "10" {
+		t.Errorf("user 1 AAPL realized %s, want 10", got)
+	}
+
+	if got := openLots(l.openTrades()); got != "buy 1@100, buy 1@213" {
+		t.Errorf("open trades %q", got)
+	}
+}
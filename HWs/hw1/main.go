@@ -1,271 +1,626 @@
 package main
 
 import (
+	"bufio"
 	"encoding/csv"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"sort"
 	"strconv"
-	"strings"
-)
+	"time"
 
-func getMaxDifference(high []float64, low []float64) (float64, float64, float64) {
-	sort.Float64s(high)
-	sort.Float64s(low)
-	return (high[len(high)-1] - low[0]), high[len(high)-1], low[0]
-}
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/columnar"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/usertrade"
+)
 
-func getMaxRevenueForEachCompany() ([]float64, []float64, []float64) {
-	csvfile, err := os.Open("candles_5m.csv")
+// readCSV streams the file record by record. The record slice is reused between calls.
+func readCSV(filename string, handle func(record []string) error) error {
+	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatalln("Couldn't open the csv file", err)
+		return fmt.Errorf("can't open %s: %s", filename, err)
 	}
 
-	reader := csv.NewReader(csvfile)
-	var appleStocksHigh []float64
-	var appleStocksLow []float64
+	defer file.Close()
+
+	return streamCSV(filename, file, handle)
+}
 
-	var amazonStocksHigh []float64
-	var amazonStocksLow []float64
+// streamCSV is readCSV of an open file.
+func streamCSV(filename string, file io.Reader, handle func(record []string) error) error {
+	reader := csv.NewReader(bufio.NewReader(file))
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
 
-	var sberStocksHigh []float64
-	var sberStocksLow []float64
 	for {
-		stockData, err := reader.Read()
+		record, err := reader.Read()
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			log.Fatal(err)
+			return fmt.Errorf("can't read %s: %s", filename, err)
 		}
 
-		if stockData[0] == "AAPL" {
-			if value, err := strconv.ParseFloat(stockData[3], 32); err == nil {
-				appleStocksHigh = append(appleStocksHigh, value)
-			}
+		if err := handle(record); err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+}
 
-			if value, err := strconv.ParseFloat(stockData[4], 32); err == nil {
-				appleStocksLow = append(appleStocksLow, value)
-			}
-		} else if stockData[0] == "AMZN" {
-			if value, err := strconv.ParseFloat(stockData[3], 32); err == nil {
-				amazonStocksHigh = append(amazonStocksHigh, value)
-			}
+type candleHandler func(ticker string, point candlePoint) error
 
-			if value, err := strconv.ParseFloat(stockData[4], 32); err == nil {
-				amazonStocksLow = append(amazonStocksLow, value)
-			}
-		} else {
-			if value, err := strconv.ParseFloat(stockData[3], 32); err == nil {
-				sberStocksHigh = append(sberStocksHigh, value)
-			}
+type tradeHandler func(trade userTrade) error
 
-			if value, err := strconv.ParseFloat(stockData[4], 32); err == nil {
-				sberStocksLow = append(sberStocksLow, value)
-			}
+// openCandles reads the candles from either a columnar or a CSV file. A columnar file
+// only reads the blocks within the time range of the filter.
+func openCandles(file *os.File, filter recordFilter) (func() (candle.Candle, error), error) {
+	if columnar.IsColumnar(file) {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		reader, err := columnar.NewCandleReader(file, info.Size())
+		if err != nil {
+			return nil, err
 		}
+
+		reader.Seek(filter.from, filter.to)
+
+		return reader.Read, nil
 	}
 
-	appleMaxDifference, appleHigh, appleLow := getMaxDifference(appleStocksHigh, appleStocksLow)
-	amazonMaxDifference, amazonHigh, amazonLow := getMaxDifference(amazonStocksHigh, amazonStocksLow)
-	sberMaxDifference, sberHigh, sberLow := getMaxDifference(sberStocksHigh, sberStocksLow)
+	reader := candle.NewReader(bufio.NewReader(file))
+	reader.Mode = candle.Lenient
+	reader.OnSkip = func(err *candle.ParseError) {
+		log.Printf("skipping candle: %s\n", err)
+	}
 
-	return []float64{appleMaxDifference, appleHigh, appleLow}, []float64{amazonMaxDifference, amazonHigh, amazonLow}, []float64{sberMaxDifference, sberHigh, sberLow}
+	return reader.Read, nil
 }
 
-func getUsersRevenue(companyTicker string) map[string]string {
-	csvfile, err := os.Open("user_trades.csv")
+func readCandles(filename string, filter recordFilter, handlers ...candleHandler) error {
+	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatalln("Couldn't open the csv file", err)
+		return fmt.Errorf("can't open %s: %s", filename, err)
 	}
-	r := csv.NewReader(csvfile)
 
-	tableBuy := make(map[string]string)
-	tableSell := make(map[string]string)
+	defer file.Close()
 
-	tableResult := make(map[string]string)
+	next, err := openCandles(file, filter)
+	if err != nil {
+		return fmt.Errorf("can't read %s: %s", filename, err)
+	}
 
 	for {
-		stock, err := r.Read()
+		c, err := next()
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			log.Fatal(err)
+			return fmt.Errorf("can't read %s: %s", filename, err)
 		}
 
-		if stock[2] == companyTicker {
-			if stock[3] != "0" {
-				tableBuy[stock[0]] = stock[3]
-			}
+		c.Ticker = normalizeTicker(c.Ticker)
+
+		if !filter.match(c.Ticker, c.Timestamp) {
+			continue
+		}
+
+		point := candlePoint{
+			timestamp: c.Timestamp,
+			open:      c.OpeningPrice,
+			high:      c.MaxPrice,
+			low:       c.MinPrice,
+			close:     c.ClosingPrice,
+			volume:    c.Volume,
+			vwap:      c.VWAP,
+		}
 
-			if stock[4] != "0" {
-				tableSell[stock[0]] = stock[4]
+		for _, handle := range handlers {
+			if err := handle(c.Ticker, point); err != nil {
+				return fmt.Errorf("%s: %s", filename, err)
 			}
 		}
 	}
+}
+
+func getMaxRevenueForEachCompany(bestTrades map[string]*bestTrade, policy windowPolicy, allWindows bool) candleHandler {
+	return func(ticker string, point candlePoint) error {
+		best, ok := bestTrades[ticker]
+		if !ok {
+			best = newBestTrade(policy, allWindows)
+			bestTrades[ticker] = best
+		}
 
-	for stock := range tableBuy {
-		var buyStock float64
-		var sellStock float64
+		return best.add(point)
+	}
+}
 
-		if val, err := strconv.ParseFloat(tableSell[stock], 64); err == nil {
-			sellStock = val
+// parseUserTrade reads a user_id,time,ticker,buy_price,sell_price[,quantity] record.
+// The quantity is in lots and defaults to one lot.
+func parseUserTrade(record []string, instruments instrumentTable) (userTrade, rejection) {
+	if len(record) != len(usertrade.Columns)-1 && len(record) != len(usertrade.Columns) {
+		return userTrade{}, badRecordError{fields: len(record)}
+	}
+
+	if reject := validateUserID(record[0]); reject != nil {
+		return userTrade{}, reject
+	}
+
+	trade, err := usertrade.Parse(record)
+
+	var fieldErr *usertrade.FieldError
+	if errors.As(err, &fieldErr) {
+		switch fieldErr.Field {
+		case "time":
+			return userTrade{}, badTimestampError{value: fieldErr.Value, err: fieldErr.Err}
+		case "quantity":
+			return userTrade{}, badQuantityError{value: fieldErr.Value}
+		default:
+			return userTrade{}, badPriceError{value: fieldErr.Value, err: fieldErr.Err}
 		}
+	}
+
+	return checkUserTrade(trade, instruments)
+}
 
-		if val, err := strconv.ParseFloat(tableBuy[stock], 64); err == nil {
-			buyStock = val
+// checkUserTrade checks the fields of a user trade, parsed from a record or read from a
+// columnar file.
+func checkUserTrade(trade usertrade.Trade, instruments instrumentTable) (userTrade, rejection) {
+	if reject := validateUserID(trade.UserID); reject != nil {
+		return userTrade{}, reject
+	}
+
+	for _, price := range []decimal.Decimal{trade.BuyPrice, trade.SellPrice} {
+		if price.IsNegative() {
+			return userTrade{}, negativePriceError{price: price}
 		}
+	}
+
+	if trade.Lots <= 0 {
+		return userTrade{}, badQuantityError{value: strconv.FormatInt(trade.Lots, 10)}
+	}
 
-		res := betterFormat(sellStock - buyStock)
-		tableResult[stock] = res
+	return newUserTrade(trade.UserID, trade.Timestamp, trade.Ticker, trade.BuyPrice, trade.SellPrice, trade.Lots,
+		instruments)
+}
+
+// newUserTrade makes a trade of the side whose price is set.
+func newUserTrade(userID string, timestamp time.Time, ticker string, buy, sell decimal.Decimal, lots int64,
+	instruments instrumentTable) (userTrade, rejection) {
+	if buy.IsZero() == sell.IsZero() {
+		return userTrade{}, badSideError{buy: buy, sell: sell}
+	}
+
+	trade := userTrade{
+		userID:    userID,
+		timestamp: timestamp,
+		ticker:    normalizeTicker(ticker),
+		side:      buySide,
+		price:     buy,
+	}
+
+	if buy.IsZero() {
+		trade.side = sellSide
+		trade.price = sell
 	}
 
-	return tableResult
+	// The quantity and the notional must not overflow later arithmetic.
+	lotSize := instruments.lotSize(trade.ticker)
+	trade.quantity = lots * lotSize
+
+	if trade.quantity/lotSize != lots {
+		return userTrade{}, quantityRangeError{lots: lots, lotSize: lotSize, price: trade.price}
+	}
+
+	if _, err := trade.price.CheckedMulInt(trade.quantity); err != nil {
+		return userTrade{}, quantityRangeError{lots: lots, lotSize: lotSize, price: trade.price}
+	}
+
+	return trade, nil
 }
 
-func betterFormat(num float64) string {
-	s := fmt.Sprintf("%.2f", num)
-	return strings.TrimRight(strings.TrimRight(s, "0"), ".")
+// readUserTrades reads the trades from either a columnar or a CSV file. A columnar file
+// only reads the blocks within the time range of the filter.
+func readUserTrades(filename string, filter recordFilter, validator tradeValidator, rejects *rejectLog,
+	handlers ...tradeHandler) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("can't open %s: %s", filename, err)
+	}
+
+	defer file.Close()
+
+	accepted := 0
+
+	process := func(trade userTrade, reject rejection, record func() []string) error {
+		if reject == nil && !filter.match(trade.ticker, trade.timestamp) {
+			return nil
+		}
+
+		if reject == nil {
+			reject = validator.validate(trade)
+		}
+
+		if reject != nil {
+			return rejects.add(record(), reject)
+		}
+
+		accepted++
+
+		for _, handle := range handlers {
+			if err := handle(trade); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if columnar.IsColumnar(file) {
+		err = readColumnarUserTrades(filename, file, filter, func(t usertrade.Trade) error {
+			trade, reject := checkUserTrade(t, validator.instruments)
+			return process(trade, reject, t.Record)
+		})
+	} else {
+		err = streamCSV(filename, file, func(record []string) error {
+			trade, reject := parseUserTrade(record, validator.instruments)
+			return process(trade, reject, func() []string { return record })
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	rejects.logSummary(accepted)
+
+	return rejects.close()
 }
 
-func getTimeToSellAndBuyForCompany(companyTicker string, highVal float64, lowVal float64) []string {
-	csvfile, err := os.Open("candles_5m.csv")
+func readColumnarUserTrades(filename string, file *os.File, filter recordFilter,
+	handle func(trade usertrade.Trade) error) error {
+	info, err := file.Stat()
 	if err != nil {
-		log.Fatalln("Couldn't open the csv file", err)
+		return fmt.Errorf("can't read %s: %s", filename, err)
 	}
 
-	r := csv.NewReader(csvfile)
+	reader, err := columnar.NewUserTradeReader(file, info.Size())
+	if err != nil {
+		return fmt.Errorf("can't read %s: %s", filename, err)
+	}
+
+	reader.Seek(filter.from, filter.to)
 
-	var buySellTimeAndDate []string
 	for {
-		record, err := r.Read()
+		trade, err := reader.Read()
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			log.Fatal(err)
+			return fmt.Errorf("can't read %s: %s", filename, err)
 		}
 
-		if companyTicker == "AAPL" {
-			if record[0] == "AAPL" && record[3] == betterFormat(highVal) {
-				buySellTimeAndDate = append(buySellTimeAndDate, record[1])
-			}
+		if err := handle(trade); err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+}
 
-			if record[0] == "AAPL" && record[4] == betterFormat(lowVal) {
-				buySellTimeAndDate = append(buySellTimeAndDate, record[1])
-			}
-		} else if companyTicker == "AMZN" {
-			if record[0] == "AMZN" && record[3] == betterFormat(highVal) {
-				buySellTimeAndDate = append(buySellTimeAndDate, record[1])
-			}
+func getUsersRevenue(userLedger *ledger) tradeHandler {
+	return userLedger.add
+}
 
-			if record[0] == "AMZN" && record[4] == betterFormat(lowVal) {
-				buySellTimeAndDate = append(buySellTimeAndDate, record[1])
-			}
-		} else {
-			if record[0] == "SBER" && record[3] == betterFormat(highVal) {
-				buySellTimeAndDate = append(buySellTimeAndDate, record[1])
+func run(cfg config) error {
+	maxRevenues := make(map[string]*bestTrade)
+	candleHandlers := []candleHandler{getMaxRevenueForEachCompany(maxRevenues, cfg.windowPolicy, cfg.windowsFile != "")}
+
+	var (
+		index     *candleIndex
+		fills     *reconciler
+		execution *executionStats
+	)
+
+	if cfg.anomaliesFile != "" || cfg.anomalySummaryFile != "" || cfg.executionFile != "" ||
+		cfg.executionTradesFile != "" {
+		index = newCandleIndex(cfg.candleInterval)
+		candleHandlers = append(candleHandlers, index.addCandle)
+	}
+
+	if cfg.anomaliesFile != "" || cfg.anomalySummaryFile != "" {
+		fills = newReconciler(index)
+	}
+
+	if cfg.executionFile != "" || cfg.executionTradesFile != "" {
+		execution = newExecutionStats(index)
+	}
+
+	if err := readCandles(cfg.candlesFile, cfg.filter, candleHandlers...); err != nil {
+		return err
+	}
+
+	rejects, err := newRejectLog(cfg.rejectsFile, cfg.output.header)
+	if err != nil {
+		return err
+	}
+
+	defer rejects.close()
+
+	instruments, err := loadInstruments(cfg.instrumentsFile)
+	if err != nil {
+		return err
+	}
+
+	fees, err := loadFeeModel(cfg.feesFile, instruments)
+	if err != nil {
+		return err
+	}
+
+	var reporting *reportingCurrency
+	if cfg.currency != "" {
+		rates, err := loadFXRates(cfg.fxFile)
+		if err != nil {
+			return err
+		}
+
+		reporting = &reportingCurrency{code: cfg.currency, instruments: instruments, rates: rates}
+	}
+
+	usersLedger := newLedger(reporting)
+	tradeHandlers := []tradeHandler{chargeFees(fees, getUsersRevenue(usersLedger))}
+
+	if fills != nil {
+		if cfg.anomaliesFile != "" {
+			if fills.anomalies, err = createCSVStream(cfg.anomaliesFile, anomalyHeader, cfg.output.header); err != nil {
+				return err
 			}
 
-			if record[0] == "SBER" && record[4] == betterFormat(lowVal) {
-				buySellTimeAndDate = append(buySellTimeAndDate, record[1])
+			defer fills.anomalies.close()
+		}
+
+		tradeHandlers = append(tradeHandlers, fills.addTrade)
+	}
+
+	if execution != nil {
+		if cfg.executionTradesFile != "" {
+			execution.trades, err = createCSVStream(cfg.executionTradesFile, executionTradeHeader, cfg.output.header)
+			if err != nil {
+				return err
 			}
+
+			defer execution.trades.close()
 		}
+
+		tradeHandlers = append(tradeHandlers, execution.addTrade)
+	}
+
+	validator := tradeValidator{bestTrades: maxRevenues, instruments: instruments, interval: cfg.candleInterval}
+
+	if err := readUserTrades(cfg.tradesFile, cfg.filter, validator, rejects, tradeHandlers...); err != nil {
+		return err
 	}
 
-	return buySellTimeAndDate
+	if fills != nil {
+		if err := fills.close(); err != nil {
+			return err
+		}
+	}
+
+	if execution != nil {
+		if err := execution.close(); err != nil {
+			return err
+		}
+	}
+
+	return writeReports(cfg, maxRevenues, usersLedger, instruments, fees, fills, execution)
 }
 
-func main() {
-	appleMaxRevenueArr, amazonMaxRevenueArr, sberMaxRevenueArr := getMaxRevenueForEachCompany()
+func writeReports(cfg config, maxRevenues map[string]*bestTrade, usersLedger *ledger, instruments instrumentTable,
+	fees feeModel, fills *reconciler, execution *executionStats) error {
+	result := table{
+		header: []string{"user_id", "ticker", "user_revenue", "max_revenue", "diff", "sell_time", "buy_time"},
+	}
+
+	for _, ticker := range usersLedger.tickers() {
+		companyMaxRevenue, ok := maxRevenues[ticker]
+		if !ok || !companyMaxRevenue.found {
+			log.Printf("no candles for %s, skipping\n", ticker)
+			continue
+		}
+
+		for _, userID := range usersLedger.users(ticker) {
+			pos := usersLedger.position(userID, ticker)
+
+			userRevenue, err := pos.netPnL()
+			if err != nil {
+				return fmt.Errorf("user %s %s: net PnL: %w", userID, ticker, err)
+			}
 
-	appleMaxRevenue := appleMaxRevenueArr[0]
-	amazonMaxRevenue := amazonMaxRevenueArr[0]
-	sberMaxRevenue := sberMaxRevenueArr[0]
+			netMaxRevenue, err := netRevenue(fees, userID, ticker, companyMaxRevenue, pos.size())
+			if err != nil {
+				return err
+			}
+
+			currentMaxRevenue := netMaxRevenue.String()
+
+			diff, err := netMaxRevenue.CheckedSub(userRevenue)
+			if err != nil {
+				return fmt.Errorf("user %s %s: diff: %w", userID, ticker, err)
+			}
+
+			buyDate := companyMaxRevenue.buyTime.Format(time.RFC3339)
+			sellDate := companyMaxRevenue.sellTime.Format(time.RFC3339)
 
-	appleUsersRevenueMap := getUsersRevenue("AAPL")
-	appleBestTimes := getTimeToSellAndBuyForCompany("AAPL", appleMaxRevenueArr[1], appleMaxRevenueArr[2])
+			result.rows = append(result.rows, []string{
+				userID, ticker, userRevenue.String(), currentMaxRevenue, diff.String(), sellDate, buyDate,
+			})
+		}
+	}
 
-	var data [][]string
+	if err := writeTable(cfg.outputFile, cfg.output, result); err != nil {
+		return err
+	}
 
-	for stock := range appleUsersRevenueMap {
-		userID := stock
-		ticker := "AAPL"
-		userRevenue := appleUsersRevenueMap[stock]
-		currentMaxRevenue := betterFormat(appleMaxRevenue)
+	if cfg.pnlFile != "" {
+		pnl, err := pnlTable(usersLedger, instruments)
+		if err != nil {
+			return err
+		}
 
-		var usersRevenueFloat float64
-		if val, err := strconv.ParseFloat(appleUsersRevenueMap[stock], 64); err == nil {
-			usersRevenueFloat = val
+		if err := writeTable(cfg.pnlFile, cfg.output, pnl); err != nil {
+			return err
 		}
+	}
 
-		diff := betterFormat(appleMaxRevenue - usersRevenueFloat)
-		buyDate := appleBestTimes[0]
-		sellDate := appleBestTimes[1]
+	if cfg.leaderboardFile != "" {
+		ranking, err := scoreUsers(usersLedger, maxRevenues, fees, instruments)
+		if err != nil {
+			return err
+		}
 
-		data = append(data, []string{userID, ticker, userRevenue, currentMaxRevenue, diff, sellDate, buyDate})
+		leaderboard := leaderboardTable(ranking, cfg.top, cfg.bottom)
+		if err := writeTable(cfg.leaderboardFile, cfg.output, leaderboard); err != nil {
+			return err
+		}
 	}
 
-	amazonUsersRevenueMap := getUsersRevenue("AMZN")
-	amazonBestTimes := getTimeToSellAndBuyForCompany("AMZN", amazonMaxRevenueArr[1], amazonMaxRevenueArr[2])
+	if cfg.windowsFile != "" {
+		if err := writeTable(cfg.windowsFile, cfg.output, windowsTable(maxRevenues)); err != nil {
+			return err
+		}
+	}
 
-	for stock := range amazonUsersRevenueMap {
-		userID := stock
-		ticker := "AMZN"
-		userRevenue := amazonUsersRevenueMap[stock]
-		currentMaxRevenue := betterFormat(amazonMaxRevenue)
+	if cfg.anomalySummaryFile != "" {
+		if err := writeTable(cfg.anomalySummaryFile, cfg.output, fills.summaryTable()); err != nil {
+			return err
+		}
+	}
 
-		var usersRevenueFloat float64
-		if val, err := strconv.ParseFloat(amazonUsersRevenueMap[stock], 64); err == nil {
-			usersRevenueFloat = val
+	if cfg.executionFile != "" {
+		if err := writeTable(cfg.executionFile, cfg.output, execution.summaryTable()); err != nil {
+			return err
 		}
+	}
 
-		diff := betterFormat(amazonMaxRevenue - usersRevenueFloat)
-		buyDate := amazonBestTimes[0]
-		sellDate := amazonBestTimes[1]
+	if cfg.openPositionsFile == "" {
+		return nil
+	}
 
-		data = append(data, []string{userID, ticker, userRevenue, currentMaxRevenue, diff, sellDate, buyDate})
+	openPositions := table{header: []string{"user_id", "ticker", "side", "price", "quantity", "time"}}
+	for _, trade := range usersLedger.openTrades() {
+		openPositions.rows = append(openPositions.rows, []string{
+			trade.userID, trade.ticker, trade.side.String(), trade.price.String(), strconv.FormatInt(trade.quantity, 10),
+			trade.timestamp.Format(time.RFC3339),
+		})
 	}
 
-	sberUsersRevenueMap := getUsersRevenue("SBER")
-	sberBestTimes := getTimeToSellAndBuyForCompany("SBER", sberMaxRevenueArr[1], sberMaxRevenueArr[2])
+	return writeTable(cfg.openPositionsFile, cfg.output, openPositions)
+}
 
-	for stock := range sberUsersRevenueMap {
-		userID := stock
-		ticker := "SBER"
-		userRevenue := sberUsersRevenueMap[stock]
-		currentMaxRevenue := betterFormat(sberMaxRevenue)
+// pnlTable sums up PnL per user, in the reporting currency if there is one and per
+// instrument currency otherwise.
+func pnlTable(usersLedger *ledger, instruments instrumentTable) (table, error) {
+	type userPnL struct {
+		userID   string
+		currency string
+		gross    decimal.Decimal
+		fees     decimal.Decimal
+	}
 
-		var usersRevenueFloat float64
-		if val, err := strconv.ParseFloat(sberUsersRevenueMap[stock], 64); err == nil {
-			usersRevenueFloat = val
+	users := make(map[positionKey]*userPnL)
+	for key, pos := range usersLedger.positions {
+		currency, gross, fees := instruments.currency(key.ticker), pos.realizedPnL(), pos.fees
+		if usersLedger.reporting != nil {
+			currency, gross, fees = usersLedger.reporting.code, pos.convertedRealized, pos.convertedFees
 		}
 
-		diff := betterFormat(sberMaxRevenue - usersRevenueFloat)
-		buyDate := sberBestTimes[0]
-		sellDate := sberBestTimes[1]
+		userKey := positionKey{userID: key.userID, ticker: currency}
+
+		pnl, ok := users[userKey]
+		if !ok {
+			pnl = &userPnL{userID: key.userID, currency: currency}
+			users[userKey] = pnl
+		}
 
-		data = append(data, []string{userID, ticker, userRevenue, currentMaxRevenue, diff, sellDate, buyDate})
+		var err error
+
+		if pnl.gross, err = pnl.gross.CheckedAdd(gross); err != nil {
+			return table{}, fmt.Errorf("user %s: gross PnL in %s: %w", key.userID, currency, err)
+		}
+
+		if pnl.fees, err = pnl.fees.CheckedAdd(fees); err != nil {
+			return table{}, fmt.Errorf("user %s: fees in %s: %w", key.userID, currency, err)
+		}
 	}
 
-	file, err := os.Create("result.csv")
-	checkError("Cannot create file", err)
-	defer file.Close()
+	rows := make([]*userPnL, 0, len(users))
+	for _, user := range users {
+		rows = append(rows, user)
+	}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+	sort.Slice(rows, func(lhs, rhs int) bool {
+		if rows[lhs].userID != rows[rhs].userID {
+			return rows[lhs].userID < rows[rhs].userID
+		}
+
+		return rows[lhs].currency < rows[rhs].currency
+	})
+
+	pnl := table{header: []string{"user_id", "currency", "gross_pnl", "fees", "net_pnl"}}
+	for _, user := range rows {
+		net, err := user.gross.CheckedSub(user.fees)
+		if err != nil {
+			return table{}, fmt.Errorf("user %s: net PnL in %s: %w", user.userID, user.currency, err)
+		}
 
-	for _, value := range data {
-		err := writer.Write(value)
-		checkError("Cannot write to file", err)
+		pnl.rows = append(pnl.rows, []string{
+			user.userID, user.currency, user.gross.String(), user.fees.String(), net.String(),
+		})
 	}
+
+	return pnl, nil
 }
 
-func checkError(message string, err error) {
+func windowsTable(maxRevenues map[string]*bestTrade) table {
+	tickers := make([]string, 0, len(maxRevenues))
+	for ticker, best := range maxRevenues {
+		if best.found {
+			tickers = append(tickers, ticker)
+		}
+	}
+	sort.Strings(tickers)
+
+	windows := table{header: []string{"ticker", "max_revenue", "buy_time", "sell_time", "holding"}}
+	for _, ticker := range tickers {
+		best := maxRevenues[ticker]
+		for _, window := range best.windows {
+			windows.rows = append(windows.rows, []string{
+				ticker, best.revenue.String(), window.buyTime.Format(time.RFC3339), window.sellTime.Format(time.RFC3339),
+				window.holding().String(),
+			})
+		}
+	}
+
+	return windows
+}
+
+func main() {
+	cfg, err := parseFlags(os.Args[0], os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
 	if err != nil {
-		log.Fatal(message, err)
+		os.Exit(2)
+	}
+
+	if err := run(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
 	}
 }
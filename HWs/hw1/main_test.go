@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var (
+	benchTickers = []string{"AAPL", "AMZN", "SBER"}
+	benchStart   = time.Date(2019, 1, 30, 7, 0, 0, 0, time.UTC)
+)
+
+const (
+	benchCandles = 2 * 24 * 12 // two days of 5 minute candles per ticker
+	benchUsers   = 1000
+)
+
+func writeBenchFile(b *testing.B, filename string, rows int, row func(w io.Writer, i int)) {
+	b.Helper()
+
+	file, err := os.Create(filename)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	w := bufio.NewWriter(file)
+	for i := 0; i < rows; i++ {
+		row(w, i)
+	}
+
+	if err := w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+
+	if err := file.Close(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// benchInputs writes candles of a fixed time range and the given number of user trades
+// within it. Users alternate buys and sells, so their open lots stay few.
+func benchInputs(b *testing.B, dir string, trades int) (candlesFile, tradesFile string) {
+	candlesFile = filepath.Join(dir, "candles_5m.csv")
+	writeBenchFile(b, candlesFile, benchCandles*len(benchTickers), func(w io.Writer, i int) {
+		ticker := benchTickers[i%len(benchTickers)]
+		at := benchStart.Add(time.Duration(i/len(benchTickers)) * 5 * time.Minute)
+		low := 100 + i%37
+
+		fmt.Fprintf(w, "%s,%s,%d,%d,%d,%d\n", ticker, at.Format(time.RFC3339), low+1, low+3, low, low+2)
+	})
+
+	tradesFile = filepath.Join(dir, "user_trades.csv")
+	span := time.Duration(benchCandles) * 5 * time.Minute
+
+	writeBenchFile(b, tradesFile, trades, func(w io.Writer, i int) {
+		at := benchStart.Add(span * time.Duration(i) / time.Duration(trades))
+		ticker := benchTickers[i%len(benchTickers)]
+		user := i % benchUsers
+
+		buy, sell := "101.5", "0"
+		if (i/benchUsers)%2 == 1 {
+			buy, sell = "0", "102.5"
+		}
+
+		fmt.Fprintf(w, "%d,%s,%s,%s,%s\n", user, at.Format(time.RFC3339), ticker, buy, sell)
+	})
+
+	return candlesFile, tradesFile
+}
+
+// peakHeap samples the heap in use while f runs.
+func peakHeap(f func()) uint64 {
+	done := make(chan struct{})
+	peak := make(chan uint64)
+
+	go func() {
+		var stats runtime.MemStats
+
+		max := uint64(0)
+		ticker := time.NewTicker(5 * time.Millisecond)
+
+		defer ticker.Stop()
+
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapInuse > max {
+				max = stats.HeapInuse
+			}
+
+			select {
+			case <-done:
+				peak <- max
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	f()
+	close(done)
+
+	return <-peak
+}
+
+// BenchmarkRun reports the peak heap of a run next to the allocations. The allocations
+// grow with the number of trades, the peak heap should not.
+func BenchmarkRun(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, trades := range []int{10000, 100000, 1000000} {
+		b.Run(fmt.Sprintf("trades=%d", trades), func(b *testing.B) {
+			dir := b.TempDir()
+			candlesFile, tradesFile := benchInputs(b, dir, trades)
+
+			cfg := config{
+				candlesFile:    candlesFile,
+				tradesFile:     tradesFile,
+				outputFile:     filepath.Join(dir, "result.csv"),
+				windowPolicy:   earliestWindow,
+				candleInterval: 5 * time.Minute,
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			peak := uint64(0)
+
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+
+				heap := peakHeap(func() {
+					if err := run(cfg); err != nil {
+						b.Fatal(err)
+					}
+				})
+
+				if heap > peak {
+					peak = heap
+				}
+			}
+
+			b.ReportMetric(float64(peak), "peak-heap-B")
+		})
+	}
+}
+
+// TestResultFile keeps the committed result.csv in line with the default run, go run .
+// in this directory rewrites it.
+func TestResultFile(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	output := filepath.Join(t.TempDir(), "result.csv")
+
+	cfg, err := parseFlags("hw1", []string{"-output", output})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := ioutil.ReadFile("result.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Error("result.csv is stale, rewrite it with go run .")
+	}
+}
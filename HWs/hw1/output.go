@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+type outputFormat int
+
+const (
+	csvFormat outputFormat = iota
+	jsonFormat
+	tableFormat
+)
+
+func parseOutputFormat(name string) (outputFormat, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return csvFormat, nil
+	case "json":
+		return jsonFormat, nil
+	case "table":
+		return tableFormat, nil
+	default:
+		return csvFormat, fmt.Errorf("unknown format %q, expected csv, json or table", name)
+	}
+}
+
+type outputOptions struct {
+	format outputFormat
+	header bool
+}
+
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// writeTable writes the table to filename, "-" stands for stdout.
+func writeTable(filename string, options outputOptions, data table) (err error) {
+	out := io.Writer(os.Stdout)
+
+	if filename != "-" {
+		file, createErr := os.Create(filename)
+		if createErr != nil {
+			return fmt.Errorf("can't create %s: %s", filename, createErr)
+		}
+
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("can't write %s: %s", filename, closeErr)
+			}
+		}()
+
+		out = file
+	}
+
+	writer := bufio.NewWriter(out)
+
+	switch options.format {
+	case jsonFormat:
+		err = writeJSONTable(writer, data)
+	case tableFormat:
+		err = writePrettyTable(writer, data, options.header)
+	default:
+		err = writeCSVTable(writer, data, options.header)
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if err != nil {
+		return fmt.Errorf("can't write %s: %s", filename, err)
+	}
+
+	return nil
+}
+
+func writeCSVTable(out io.Writer, data table, header bool) error {
+	writer := csv.NewWriter(out)
+
+	if header {
+		if err := writer.Write(data.header); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range data.rows {
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// writeJSONTable writes an array of objects keyed by the header, keeping the column order.
+func writeJSONTable(out io.Writer, data table) error {
+	if _, err := io.WriteString(out, "["); err != nil {
+		return err
+	}
+
+	for i, row := range data.rows {
+		separator := ",\n  {"
+		if i == 0 {
+			separator = "\n  {"
+		}
+
+		if _, err := io.WriteString(out, separator); err != nil {
+			return err
+		}
+
+		for j, value := range row {
+			key, err := json.Marshal(data.header[j])
+			if err != nil {
+				return err
+			}
+
+			val, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+
+			if j > 0 {
+				if _, err := io.WriteString(out, ", "); err != nil {
+					return err
+				}
+			}
+
+			if _, err := fmt.Fprintf(out, "%s: %s", key, val); err != nil {
+				return err
+			}
+		}
+
+		if _, err := io.WriteString(out, "}"); err != nil {
+			return err
+		}
+	}
+
+	_, err := io.WriteString(out, "\n]\n")
+
+	return err
+}
+
+func writePrettyTable(out io.Writer, data table, header bool) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	if header {
+		if _, err := fmt.Fprintln(writer, strings.Join(data.header, "\t")); err != nil {
+			return err
+		}
+
+		dashes := make([]string, len(data.header))
+		for i, name := range data.header {
+			dashes[i] = strings.Repeat("-", len(name))
+		}
+
+		if _, err := fmt.Fprintln(writer, strings.Join(dashes, "\t")); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range data.rows {
+		if _, err := fmt.Fprintln(writer, strings.Join(row, "\t")); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// csvStream writes rows as soon as they come, for outputs that can grow as large as
+// the input, like rejected trades. It is always CSV.
+type csvStream struct {
+	file   *os.File
+	writer *csv.Writer
+	closed bool
+}
+
+// createCSVStream opens filename for writing, "-" stands for stdout.
+func createCSVStream(filename string, header []string, withHeader bool) (*csvStream, error) {
+	stream := &csvStream{}
+
+	if filename != "-" {
+		file, err := os.Create(filename)
+		if err != nil {
+			return nil, fmt.Errorf("can't create %s: %s", filename, err)
+		}
+
+		stream.file = file
+	}
+
+	out := io.Writer(os.Stdout)
+	if stream.file != nil {
+		out = stream.file
+	}
+
+	stream.writer = csv.NewWriter(out)
+
+	if withHeader {
+		if err := stream.write(header); err != nil {
+			stream.close()
+			return nil, fmt.Errorf("can't write %s: %s", filename, err)
+		}
+	}
+
+	return stream, nil
+}
+
+func (s *csvStream) write(row []string) error {
+	return s.writer.Write(row)
+}
+
+// close flushes and closes the file. It is safe to call it more than once.
+func (s *csvStream) close() error {
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+	s.writer.Flush()
+
+	err := s.writer.Error()
+	if s.file == nil {
+		return err
+	}
+
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
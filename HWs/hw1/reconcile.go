@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+var anomalyHeader = []string{
+	"user_id", "ticker", "time", "side", "price", "candle_time", "low", "high", "distance", "distance_pct",
+}
+
+type candleKey struct {
+	ticker string
+	bucket int64
+}
+
+type anomalySummary struct {
+	trades        int
+	missing       int
+	outside       int
+	maxDistance   decimal.Decimal
+	totalDistance decimal.Decimal
+}
+
+// candleIndex finds the candle a trade falls in by its ticker and time bucket.
+type candleIndex struct {
+	interval time.Duration
+	candles  map[candleKey]candlePoint
+}
+
+func newCandleIndex(interval time.Duration) *candleIndex {
+	return &candleIndex{interval: interval, candles: make(map[candleKey]candlePoint)}
+}
+
+func (c *candleIndex) bucket(ticker string, timestamp time.Time) candleKey {
+	return candleKey{ticker: ticker, bucket: timestamp.Truncate(c.interval).Unix()}
+}
+
+func (c *candleIndex) addCandle(ticker string, point candlePoint) error {
+	c.candles[c.bucket(ticker, point.timestamp)] = point
+	return nil
+}
+
+func (c *candleIndex) candle(trade userTrade) (candlePoint, bool) {
+	point, ok := c.candles[c.bucket(trade.ticker, trade.timestamp)]
+	return point, ok
+}
+
+// reconciler joins every fill to its candle and checks that the fill price is within
+// the candle [low, high] range.
+type reconciler struct {
+	index     *candleIndex
+	summary   map[string]*anomalySummary
+	anomalies *csvStream
+}
+
+func newReconciler(index *candleIndex) *reconciler {
+	return &reconciler{index: index, summary: make(map[string]*anomalySummary)}
+}
+
+// outsideDistance tells how far the price is from the candle range, zero when it is inside.
+func outsideDistance(price decimal.Decimal, point candlePoint) (distance, bound decimal.Decimal) {
+	switch {
+	case price.GreaterThan(point.high):
+		return price.Sub(point.high), point.high
+	case price.LessThan(point.low):
+		return point.low.Sub(price), point.low
+	default:
+		return decimal.Zero, decimal.Zero
+	}
+}
+
+func (r *reconciler) addTrade(trade userTrade) error {
+	summary, ok := r.summary[trade.ticker]
+	if !ok {
+		summary = &anomalySummary{}
+		r.summary[trade.ticker] = summary
+	}
+
+	summary.trades++
+
+	point, ok := r.index.candle(trade)
+	if !ok {
+		summary.missing++
+		return nil
+	}
+
+	distance, bound := outsideDistance(trade.price, point)
+	if distance.IsZero() {
+		return nil
+	}
+
+	totalDistance, err := summary.totalDistance.CheckedAdd(distance)
+	if err != nil {
+		return fmt.Errorf("total distance of %s: %w", trade.ticker, err)
+	}
+
+	summary.outside++
+	summary.totalDistance = totalDistance
+	summary.maxDistance = decimal.Max(summary.maxDistance, distance)
+
+	if r.anomalies == nil {
+		return nil
+	}
+
+	distancePct, err := percent(distance, bound)
+	if err != nil {
+		return fmt.Errorf("distance of %s from %s: %w", trade.price, bound, err)
+	}
+
+	return r.anomalies.write([]string{
+		trade.userID,
+		trade.ticker,
+		trade.timestamp.Format(time.RFC3339),
+		trade.side.String(),
+		trade.price.String(),
+		point.timestamp.Format(time.RFC3339),
+		point.low.String(),
+		point.high.String(),
+		distance.String(),
+		distancePct.StringFixed(2),
+	})
+}
+
+func (r *reconciler) close() error {
+	if r.anomalies == nil {
+		return nil
+	}
+
+	return r.anomalies.close()
+}
+
+func (r *reconciler) summaryTable() table {
+	summary := table{
+		header: []string{"ticker", "trades", "missing_candle", "outside_range", "outside_pct", "max_distance", "avg_distance"},
+	}
+
+	tickers := make([]string, 0, len(r.summary))
+	for ticker := range r.summary {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+
+	for _, ticker := range tickers {
+		stats := r.summary[ticker]
+
+		avgDistance, err := stats.totalDistance.Div(decimal.FromInt(int64(stats.outside)))
+		if err != nil {
+			avgDistance = decimal.Zero
+		}
+
+		// At most all the trades are outside, so the share fits.
+		outsidePct, _ := percent(decimal.FromInt(int64(stats.outside)), decimal.FromInt(int64(stats.trades)))
+
+		summary.rows = append(summary.rows, []string{
+			ticker,
+			strconv.Itoa(stats.trades),
+			strconv.Itoa(stats.missing),
+			strconv.Itoa(stats.outside),
+			outsidePct.StringFixed(2),
+			stats.maxDistance.String(),
+			avgDistance.StringFixed(2),
+		})
+	}
+
+	return summary
+}
+
+// percent returns part / whole * 100, zero for an empty whole. It fails with ErrRange
+// when the part is many times bigger than the whole.
+func percent(part, whole decimal.Decimal) (decimal.Decimal, error) {
+	ratio, err := part.Div(whole)
+	if errors.Is(err, decimal.ErrDivision) {
+		return decimal.Zero, nil
+	}
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return ratio.CheckedMul(decimal.FromInt(100))
+}
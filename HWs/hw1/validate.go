@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+// rejection is an error that explains why a trade was left out of the report.
+type rejection interface {
+	error
+	reason() string
+}
+
+type badRecordError struct {
+	fields int
+}
+
+func (e badRecordError) Error() string {
+	return fmt.Sprintf("expected 5 or 6 fields, got %d", e.fields)
+}
+
+func (e badRecordError) reason() string { return "bad_record" }
+
+type badUserIDError struct {
+	userID string
+}
+
+func (e badUserIDError) Error() string {
+	return fmt.Sprintf("user id %q is not a number", e.userID)
+}
+
+func (e badUserIDError) reason() string { return "bad_user_id" }
+
+type badTimestampError struct {
+	value string
+	err   error
+}
+
+func (e badTimestampError) Error() string {
+	return fmt.Sprintf("bad timestamp %q: %s", e.value, e.err)
+}
+
+func (e badTimestampError) reason() string { return "bad_timestamp" }
+
+type badPriceError struct {
+	value string
+	err   error
+}
+
+func (e badPriceError) Error() string {
+	return fmt.Sprintf("bad price %q: %s", e.value, e.err)
+}
+
+func (e badPriceError) reason() string { return "bad_price" }
+
+type negativePriceError struct {
+	price decimal.Decimal
+}
+
+func (e negativePriceError) Error() string {
+	return fmt.Sprintf("negative price %s", e.price)
+}
+
+func (e negativePriceError) reason() string { return "negative_price" }
+
+type badSideError struct {
+	buy  decimal.Decimal
+	sell decimal.Decimal
+}
+
+func (e badSideError) Error() string {
+	return fmt.Sprintf("exactly one of buy (%s) and sell (%s) prices must be set", e.buy, e.sell)
+}
+
+func (e badSideError) reason() string { return "bad_side" }
+
+type badQuantityError struct {
+	value string
+}
+
+func (e badQuantityError) Error() string {
+	return fmt.Sprintf("quantity %q is not a positive number of lots", e.value)
+}
+
+func (e badQuantityError) reason() string { return "bad_quantity" }
+
+type quantityRangeError struct {
+	lots    int64
+	lotSize int64
+	price   decimal.Decimal
+}
+
+func (e quantityRangeError) Error() string {
+	return fmt.Sprintf("%d lots of %d at %s are out of the decimal range", e.lots, e.lotSize, e.price)
+}
+
+func (e quantityRangeError) reason() string { return "quantity_out_of_range" }
+
+type unknownTickerError struct {
+	ticker string
+}
+
+func (e unknownTickerError) Error() string {
+	return fmt.Sprintf("no candles for ticker %q", e.ticker)
+}
+
+func (e unknownTickerError) reason() string { return "unknown_ticker" }
+
+type outOfCoverageError struct {
+	timestamp time.Time
+	from      time.Time
+	to        time.Time
+}
+
+func (e outOfCoverageError) Error() string {
+	return fmt.Sprintf("trade at %s is outside candles coverage [%s, %s)", e.timestamp.Format(time.RFC3339),
+		e.from.Format(time.RFC3339), e.to.Format(time.RFC3339))
+}
+
+func (e outOfCoverageError) reason() string { return "out_of_coverage" }
+
+type unknownInstrumentError struct {
+	ticker string
+}
+
+func (e unknownInstrumentError) Error() string {
+	return fmt.Sprintf("ticker %q is not in the instruments table", e.ticker)
+}
+
+func (e unknownInstrumentError) reason() string { return "unknown_instrument" }
+
+type badPriceStepError struct {
+	price decimal.Decimal
+	step  decimal.Decimal
+}
+
+func (e badPriceStepError) Error() string {
+	return fmt.Sprintf("price %s is not a multiple of the price step %s", e.price, e.step)
+}
+
+func (e badPriceStepError) reason() string { return "bad_price_step" }
+
+func validateUserID(userID string) rejection {
+	if userID == "" {
+		return badUserIDError{userID: userID}
+	}
+
+	for _, c := range userID {
+		if c < '0' || c > '9' {
+			return badUserIDError{userID: userID}
+		}
+	}
+
+	return nil
+}
+
+// tradeValidator checks trades against the candles: the ticker must have candles and
+// the trade has to fall into the time they cover. When an instruments table is given,
+// the ticker must be listed there and the price must be on its price step.
+type tradeValidator struct {
+	bestTrades  map[string]*bestTrade
+	instruments instrumentTable
+	interval    time.Duration
+}
+
+func (v tradeValidator) validate(trade userTrade) rejection {
+	best, ok := v.bestTrades[trade.ticker]
+	if !ok {
+		return unknownTickerError{ticker: trade.ticker}
+	}
+
+	if len(v.instruments) > 0 {
+		info, ok := v.instruments[trade.ticker]
+		if !ok {
+			return unknownInstrumentError{ticker: trade.ticker}
+		}
+
+		if !info.onStep(trade.price) {
+			return badPriceStepError{price: trade.price, step: info.priceStep}
+		}
+	}
+
+	from, to := best.first, best.last.Add(v.interval)
+	if trade.timestamp.Before(from) || !trade.timestamp.Before(to) {
+		return outOfCoverageError{timestamp: trade.timestamp, from: from, to: to}
+	}
+
+	return nil
+}
+
+// rejectLog counts rejected trades by reason and writes them to the reject file, if any.
+type rejectLog struct {
+	stream *csvStream
+	counts map[string]int
+	total  int
+}
+
+func newRejectLog(filename string, withHeader bool) (*rejectLog, error) {
+	rejects := &rejectLog{counts: make(map[string]int)}
+	if filename == "" {
+		return rejects, nil
+	}
+
+	header := []string{"user_id", "time", "ticker", "buy_price", "sell_price", "quantity", "reason", "message"}
+
+	stream, err := createCSVStream(filename, header, withHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	rejects.stream = stream
+
+	return rejects, nil
+}
+
+func (r *rejectLog) add(record []string, err rejection) error {
+	r.counts[err.reason()]++
+	r.total++
+
+	if r.stream == nil {
+		return nil
+	}
+
+	// Keep the quantity column in place so rows with and without it line up.
+	row := make([]string, 6, 8)
+	copy(row, record)
+	row = append(row, err.reason(), err.Error())
+
+	return r.stream.write(row)
+}
+
+func (r *rejectLog) close() error {
+	if r.stream == nil {
+		return nil
+	}
+
+	return r.stream.close()
+}
+
+func (r *rejectLog) summary(accepted int) string {
+	reasons := make([]string, 0, len(r.counts))
+	for reason := range r.counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	parts := make([]string, len(reasons))
+	for i, reason := range reasons {
+		parts[i] = fmt.Sprintf("%s=%d", reason, r.counts[reason])
+	}
+
+	if len(parts) == 0 {
+		return fmt.Sprintf("accepted %d trades, rejected 0", accepted)
+	}
+
+	return fmt.Sprintf("accepted %d trades, rejected %d: %s", accepted, r.total, strings.Join(parts, " "))
+}
+
+func (r *rejectLog) logSummary(accepted int) {
+	log.Println(r.summary(accepted))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "time/tzdata" // the tests don't depend on the zoneinfo of the machine
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/calendar"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+// TestSessionBuckets aggregates hourly candles on a New York exchange. The buckets start
+// at the 09:30 open, which is 14:30 UTC before the change to daylight saving time on
+// 2019-03-10 and 13:30 UTC after it. The last bucket of a day ends early at the close.
+func TestSessionBuckets(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "calendar.json")
+
+	data := `{"default": "NYSE", "exchanges": {"NYSE": {
+		"timezone": "America/New_York", "open": "09:30", "close": "16:00",
+		"weekends": ["Saturday", "Sunday"],
+		"holidays": ["2019-07-04"],
+		"half_days": [{"date": "2019-07-03", "close": "13:00"}]
+	}}}`
+	if err := ioutil.WriteFile(filename, []byte(data), 0o644); err != nil { //nolint
+		t.Fatal(err)
+	}
+
+	tradingCalendar, err := calendar.Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trades := []struct {
+		at     string
+		bucket string
+	}{
+		{at: "2019-03-08 14:29:59", bucket: ""}, // before the open
+		{at: "2019-03-08 14:45:00", bucket: "2019-03-08T14:30:00Z"},
+		{at: "2019-03-08 15:30:00", bucket: "2019-03-08T15:30:00Z"},
+		{at: "2019-03-08 20:59:59", bucket: "2019-03-08T20:30:00Z"},
+		{at: "2019-03-08 21:00:00", bucket: ""}, // at the close
+		{at: "2019-03-09 15:00:00", bucket: ""}, // Saturday
+		{at: "2019-03-11 13:30:00", bucket: "2019-03-11T13:30:00Z"},
+		{at: "2019-03-11 14:29:59", bucket: "2019-03-11T13:30:00Z"},
+		{at: "2019-03-11 19:59:59", bucket: "2019-03-11T19:30:00Z"},
+		{at: "2019-03-11 20:00:00", bucket: ""}, // 16:00 in daylight saving time
+		{at: "2019-07-03 16:59:59", bucket: "2019-07-03T16:30:00Z"},
+		{at: "2019-07-03 17:00:00", bucket: ""}, // the half-day close
+		{at: "2019-07-04 15:00:00", bucket: ""}, // a holiday
+		{at: "2019-11-04 14:30:00", bucket: "2019-11-04T14:30:00Z"},
+	}
+
+	a := newAggregator(time.Hour, tradingCalendar, skipGaps)
+
+	// want are the buckets with their number of trades.
+	var (
+		want   []string
+		counts []int64
+	)
+
+	for i, trade := range trades {
+		at, err := time.Parse(candle.TradeTimeLayout, trade.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := a.add(Trade{Ticker: "SPY", Price: decimal.FromInt(int64(i)), Amount: 1, Timestamp: at}); err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case trade.bucket == "":
+		case len(want) > 0 && want[len(want)-1] == trade.bucket:
+			counts[len(counts)-1]++
+		default:
+			want = append(want, trade.bucket)
+			counts = append(counts, 1)
+		}
+	}
+
+	if err := a.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	candles := a.take()
+	if len(candles) != len(want) {
+		t.Fatalf("got %d candles, want %d: %v", len(candles), len(want), want)
+	}
+
+	for i, c := range candles {
+		if got := c.Timestamp.Format(time.RFC3339); got != want[i] || c.Trades != counts[i] {
+			t.Errorf("candle %d: got bucket %s with %d trades, want %s with %d", i, got, c.Trades, want[i], counts[i])
+		}
+	}
+
+	if a.outside != 6 {
+		t.Errorf("got %d trades outside the sessions, want 6", a.outside)
+	}
+}
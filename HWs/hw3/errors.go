@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+)
+
+// errorPolicy tells what the pipeline does with trades it can't parse or aggregate.
+type errorPolicy int
+
+const (
+	// failFast stops the pipeline at the first bad trade.
+	failFast errorPolicy = iota
+	// skipErrors skips bad trades and counts them.
+	skipErrors
+	// deadLetter skips bad trades and writes them to a dead-letter file.
+	deadLetter
+)
+
+func parseErrorPolicy(name string) (errorPolicy, error) {
+	switch name {
+	case "fail":
+		return failFast, nil
+	case "skip":
+		return skipErrors, nil
+	case "dead-letter":
+		return deadLetter, nil
+	default:
+		return skipErrors, fmt.Errorf("unknown error policy %q, expected fail, skip or dead-letter", name)
+	}
+}
+
+// stageError is an error of a pipeline stage. Parse errors are wrapped as
+// *candle.ParseError, which has the line and column of the record, and trades that
+// overflow their candle as *rangeError.
+type stageError struct {
+	stage string
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return fmt.Sprintf("%s: %s", e.stage, e.err)
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+// rangeError is a trade that would overflow the volume or the turnover of its candle.
+type rangeError struct {
+	trade    Trade
+	interval time.Duration
+	err      error
+}
+
+func (e *rangeError) Error() string {
+	return fmt.Sprintf("%s trade at %s overflows its %s candle: %s", e.trade.Ticker,
+		e.trade.Timestamp.Format(candle.TradeTimeLayout), e.interval, e.err)
+}
+
+func (e *rangeError) Unwrap() error {
+	return e.err
+}
+
+// pipelineGroup runs the stages of the pipeline. The first error of a stage cancels
+// the context of the others and is returned by wait.
+type pipelineGroup struct {
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+	cancel context.CancelFunc
+}
+
+func newPipelineGroup(cntx context.Context) (*pipelineGroup, context.Context) {
+	cntx, cancel := context.WithCancel(cntx)
+	return &pipelineGroup{cancel: cancel}, cntx
+}
+
+func (g *pipelineGroup) run(stage func() error) {
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+
+		if err := stage(); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+func (g *pipelineGroup) wait() error {
+	g.wg.Wait()
+	g.cancel()
+
+	return g.err
+}
+
+// tradeErrors applies the error policy to the malformed trades of the reader and the
+// trades the aggregators can't add. It is safe for concurrent use.
+type tradeErrors struct {
+	policy  errorPolicy
+	mu      sync.Mutex
+	first   error
+	skipped int
+	file    *os.File
+	csv     *csv.Writer
+	err     error
+}
+
+func newTradeErrors(policy errorPolicy, deadLetterFile string) (*tradeErrors, error) {
+	errs := &tradeErrors{policy: policy}
+	if policy != deadLetter {
+		return errs, nil
+	}
+
+	file, err := os.Create(deadLetterFile)
+	if err != nil {
+		return nil, err
+	}
+
+	errs.file = file
+	errs.csv = csv.NewWriter(file)
+
+	header := append(append([]string(nil), candle.TradeColumns...), "line", "error")
+	if err := errs.csv.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return errs, nil
+}
+
+// add is the OnSkip callback of the trade reader.
+func (t *tradeErrors) add(err *candle.ParseError) {
+	t.skip(err, err.Record, strconv.Itoa(err.Line))
+}
+
+// addRange skips a trade that overflows its candle. Under failFast it returns the error
+// that stops the aggregator instead.
+func (t *tradeErrors) addRange(err *rangeError) error {
+	if t.policy == failFast {
+		return err
+	}
+
+	record := []string{
+		err.trade.Ticker,
+		err.trade.Price.String(),
+		strconv.Itoa(err.trade.Amount),
+		err.trade.Timestamp.Format(candle.TradeTimeLayout),
+	}
+
+	// The line of a trade is not known after the reader.
+	t.skip(err, record, "")
+
+	return nil
+}
+
+func (t *tradeErrors) skip(err error, record []string, line string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.first == nil {
+		t.first = err
+	}
+
+	t.skipped++
+
+	if t.policy == deadLetter {
+		// Keep the columns in place for records with missing fields.
+		row := make([]string, len(candle.TradeColumns), len(candle.TradeColumns)+2)
+		copy(row, record)
+		row = append(row, line, err.Error())
+
+		if writeErr := t.csv.Write(row); writeErr != nil && t.err == nil {
+			t.err = writeErr
+		}
+	}
+}
+
+// check returns the error that has to stop the reader, if any.
+func (t *tradeErrors) check() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.policy == failFast && t.first != nil {
+		return t.first
+	}
+
+	return t.err
+}
+
+// close is called once every stage has returned.
+func (t *tradeErrors) close() error {
+	if t.policy != failFast && t.skipped > 0 {
+		log.Printf("skipped %d trades, the first one: %s", t.skipped, t.first)
+	}
+
+	if t.file == nil {
+		return nil
+	}
+
+	t.csv.Flush()
+
+	if err := t.csv.Error(); err != nil {
+		t.file.Close()
+		return err
+	}
+
+	return t.file.Close()
+}
@@ -0,0 +1,93 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// pipeTrades makes the input of the pipeline a named pipe that is never closed, so the
+// pipeline reads it until it is stopped. The returned channel is closed once n trades
+// are written, by then the pipeline has read all but a pipe buffer of them.
+func pipeTrades(t *testing.T, options *pipelineOptions, n int) <-chan struct{} {
+	t.Helper()
+
+	options.filename = filepath.Join(t.TempDir(), "trades.pipe")
+	if err := syscall.Mkfifo(options.filename, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Opened for reading too, so that the open doesn't wait for the pipeline.
+	pipe, err := os.OpenFile(options.filename, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	written, stopped := make(chan struct{}), make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		// The write fails once the test closes the pipe.
+		if writeTradeRows(pipe, n, -1) == nil {
+			close(written)
+		}
+	}()
+
+	t.Cleanup(func() {
+		pipe.Close()
+		<-stopped
+	})
+
+	return written
+}
+
+// TestCancelMidStream cancels the pipeline while it has trades to aggregate and, with a
+// few trades, while it waits for more.
+func TestCancelMidStream(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		for _, trades := range []int{leakTrades, 10} {
+			options := testOptions(t, "", t.TempDir())
+			options.workers = workers
+			written := pipeTrades(t, &options, trades)
+
+			cntx, cancel := context.WithCancel(context.Background())
+
+			stop := func() {
+				<-written
+				cancel()
+			}
+
+			if err := runStopped(t, cntx, options, stop); err != nil {
+				t.Errorf("%d workers, %d trades: %s", workers, trades, err)
+			}
+
+			cancel()
+		}
+	}
+}
+
+// TestTimeout times out the pipeline while it waits for more trades.
+func TestTimeout(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		options := testOptions(t, "", t.TempDir())
+		options.workers = workers
+		// The pipeline may stop reading before all the trades are written, the cleanup
+		// of the pipe stops the writes.
+		pipeTrades(t, &options, leakTrades)
+
+		cntx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+
+		if err := runStopped(t, cntx, options, nil); err != nil {
+			t.Errorf("%d workers: %s", workers, err)
+		}
+
+		cancel()
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+)
+
+const (
+	leakTrades = 300000
+	// leakDeadline is how long the pipeline and its goroutines get to return, it only
+	// runs out when they don't.
+	leakDeadline = 10 * time.Second
+)
+
+// runStopped runs the pipeline, calls stop, if any, while it runs and checks that the
+// pipeline returns and that all of its goroutines have returned by then.
+func runStopped(t *testing.T, cntx context.Context, options pipelineOptions, stop func()) error {
+	t.Helper()
+
+	before := runtime.NumGoroutine()
+	done := make(chan error, 1)
+
+	go func() {
+		done <- runPipeline(cntx, options)
+	}()
+
+	if stop != nil {
+		stop()
+	}
+
+	var err error
+
+	select {
+	case err = <-done:
+	case <-time.After(leakDeadline):
+		t.Fatalf("the pipeline did not return:\n%s", stacks())
+	}
+
+	// A goroutine that has sent its result may take a moment to exit.
+	for deadline := time.Now().Add(leakDeadline); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines before the pipeline, %d after:\n%s", before, runtime.NumGoroutine(), stacks())
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	return err
+}
+
+func stacks() []byte {
+	buf := make([]byte, 1<<20)
+	return buf[:runtime.Stack(buf, true)]
+}
+
+func leakOptions(t *testing.T, workers, malformed int) pipelineOptions {
+	dir := t.TempDir()
+	trades := filepath.Join(dir, "trades.csv")
+	writeTrades(t, trades, leakTrades, malformed)
+
+	options := testOptions(t, trades, dir)
+	options.workers = workers
+
+	return options
+}
+
+func TestReadError(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		options := leakOptions(t, workers, leakTrades/2)
+
+		err := runStopped(t, context.Background(), options, nil)
+
+		var parseErr *candle.ParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != leakTrades/2+1 {
+			t.Errorf("%d workers: got %v, want a parse error on line %d", workers, err, leakTrades/2+1)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		options := leakOptions(t, workers, -1)
+		options.dir = filepath.Join(options.dir, "missing")
+
+		var stageErr *stageError
+		if err := runStopped(t, context.Background(), options, nil); !errors.As(err, &stageErr) {
+			t.Errorf("%d workers: got %v, want a write error", workers, err)
+		}
+	}
+}
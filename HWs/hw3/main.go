@@ -3,315 +3,807 @@ package main
 import (
 	"bufio"
 	"context"
-	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
-	"sort"
-	"strconv"
-	"strings"
+	"os/signal"
+	"path/filepath"
 	"sync"
+	"syscall"
 	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/calendar"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/columnar"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/parquet"
 )
 
-type Candle struct {
-	Ticker       string
-	Timestamp    time.Time
-	OpeningPrice float64
-	MaxPrice     float64
-	MinPrice     float64
-	ClosingPrice float64
-}
+type Candle = candle.Candle
 
-type Trade struct {
-	Ticker    string
-	Price     float64
-	Amount    int
-	Timestamp time.Time
-}
+type Trade = candle.Trade
 
-// helper functions
-func getMaxCandlePrice(trade []Trade) float64 {
-	maxPriceValue := trade[0].Price
+// openTrades reads the trades from either a columnar or a CSV file. A columnar file
+// only reads the blocks within the [from, to) range. Malformed CSV records are passed
+// to onSkip.
+func openTrades(file *os.File, from, to time.Time, onSkip func(err *candle.ParseError)) (func() (Trade, error), error) {
+	if columnar.IsColumnar(file) {
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
 
-	for _, currentValue := range trade {
-		if currentValue.Price > maxPriceValue {
-			maxPriceValue = currentValue.Price
+		reader, err := columnar.NewTradeReader(file, info.Size())
+		if err != nil {
+			return nil, err
 		}
+
+		reader.Seek(from, to)
+
+		return reader.Read, nil
 	}
 
-	return maxPriceValue
+	reader := candle.NewTradeReader(bufio.NewReader(file))
+	reader.Mode = candle.Lenient
+	reader.OnSkip = onSkip
+
+	return reader.Read, nil
 }
 
-func getMinCandlePrice(trade []Trade) float64 {
-	minPriceValue := trade[0].Price
+func inRange(timestamp, from, to time.Time) bool {
+	return (from.IsZero() || !timestamp.Before(from)) && (to.IsZero() || timestamp.Before(to))
+}
+
+// tradeBatch is the number of trades sent over a pipeline channel at once.
+const tradeBatch = 1024
+
+// readTrades sends the trades within the [from, to) range in batches until the end of
+// the input or until the pipeline is cancelled. With more than one channel the trades
+// are split among them by ticker, see tradeShards.
+func readTrades(cntx context.Context, next func() (Trade, error), errs *tradeErrors, from, to time.Time,
+	resultFiles []chan []Trade) error {
+	shards := newTradeShards(len(resultFiles))
+	batches := make([][]Trade, len(resultFiles))
+
+	for shard := range batches {
+		batches[shard] = make([]Trade, 0, tradeBatch)
+	}
+
+	send := func(shard int) bool {
+		if len(batches[shard]) == 0 {
+			return true
+		}
 
-	for _, currentValue := range trade {
-		if currentValue.Price < minPriceValue {
-			minPriceValue = currentValue.Price
+		select {
+		case resultFiles[shard] <- batches[shard]:
+			batches[shard] = make([]Trade, 0, tradeBatch)
+			return true
+		case <-cntx.Done():
+			return false
 		}
 	}
 
-	return minPriceValue
-}
+	sendAll := func() {
+		for shard := range batches {
+			if !send(shard) {
+				return
+			}
+		}
+	}
+
+	for {
+		trade, err := next()
+		if policyErr := errs.check(); policyErr != nil {
+			sendAll()
+			return policyErr
+		}
 
-func candleFormat(candle Candle) string {
-	timestamp := candle.Timestamp.Format(time.RFC3339)
-	openingPrice := strconv.FormatFloat(candle.OpeningPrice, 'f', -1, 64)
-	maxPrice := strconv.FormatFloat(candle.MaxPrice, 'f', -1, 64)
-	minPrice := strconv.FormatFloat(candle.MinPrice, 'f', -1, 64)
-	closingPrice := strconv.FormatFloat(candle.ClosingPrice, 'f', -1, 64)
+		if err == io.EOF {
+			sendAll()
+			return nil
+		}
+
+		if err != nil {
+			sendAll()
+			return err
+		}
+
+		if !inRange(trade.Timestamp, from, to) {
+			continue
+		}
 
-	resultString := fmt.Sprintf("%s,%s,%s,%s,%s,%s\n", candle.Ticker, timestamp, openingPrice, maxPrice, minPrice, closingPrice)
+		shard := shards.of(trade.Ticker)
+		batches[shard] = append(batches[shard], trade)
 
-	return resultString
+		if len(batches[shard]) == tradeBatch && !send(shard) {
+			return nil
+		}
+	}
 }
 
-func readFileConcurrently(cntx context.Context, filename string, start <-chan struct{}) (<-chan Trade, error) { //nolint
-	resultFile := make(chan Trade)
-	tradesCSV, err := os.Open(filename)
+// readFileConcurrently reads the trades on a channel per worker.
+func readFileConcurrently(cntx context.Context, group *pipelineGroup, filename string, from, to time.Time,
+	workers int, errs *tradeErrors, start <-chan struct{}) ([]<-chan []Trade, error) {
+	resultFiles := make([]chan []Trade, workers)
+	outputs := make([]<-chan []Trade, workers)
+
+	for i := range resultFiles {
+		resultFiles[i] = make(chan []Trade)
+		outputs[i] = resultFiles[i]
+	}
+
+	tradesFile, err := os.Open(filename)
 
 	if err != nil {
 		return nil, fmt.Errorf("fatal error, can't open file: %s", err)
 	}
 
-	reader := csv.NewReader(bufio.NewReader(tradesCSV))
+	next, err := openTrades(tradesFile, from, to, errs.add)
+	if err != nil {
+		tradesFile.Close()
+		return nil, fmt.Errorf("can't read %s: %s", filename, err)
+	}
 
-	go func(file *os.File) {
-		defer file.Close()
-		defer close(resultFile)
+	group.run(func() error {
+		defer tradesFile.Close()
+		defer func() {
+			for _, resultFile := range resultFiles {
+				close(resultFile)
+			}
+		}()
 
 		<-start
 
-		for {
-			line, err := reader.Read()
+		// A cancelled pipeline closes the file to stop a read that waits for more input,
+		// e.g. from a pipe.
+		read := make(chan struct{})
+		defer close(read)
 
-			if err == io.EOF {
-				return
+		go func() {
+			select {
+			case <-cntx.Done():
+				tradesFile.Close()
+			case <-read:
 			}
+		}()
 
-			timestamp := line[3]
+		if err := readTrades(cntx, next, errs, from, to, resultFiles); err != nil {
+			if cntx.Err() != nil && errors.Is(err, os.ErrClosed) {
+				return nil
+			}
 
-			tsDate := strings.Split(timestamp, " ")[0]
-			tsTime := strings.Split(timestamp, " ")[1]
+			return &stageError{stage: "read " + filename, err: err}
+		}
 
-			timestampData, err := time.Parse(time.RFC3339, tsDate+"T"+tsTime+"Z")
+		return nil
+	})
 
-			if err != nil {
-				fmt.Println("Couldn't parse time: ", err)
-			}
+	return outputs, nil
+}
 
-			price, err := strconv.ParseFloat(line[1], 64)
+func writeCSV(candles []Candle, file io.Writer) error {
+	writer := candle.NewWriter(file)
 
-			if err != nil {
-				fmt.Println("Couldn't parse price: ", err)
-			}
+	for _, c := range candles {
+		if err := writer.Write(c); err != nil {
+			return err
+		}
+	}
 
-			count, err := strconv.Atoi(line[2])
+	return writer.Flush()
+}
 
-			if err != nil {
-				fmt.Println("Couldn't parse amount: ", err)
-			}
+func writeParquet(candles []Candle, file io.Writer) error {
+	buffered := bufio.NewWriter(file)
+	writer := parquet.NewWriter(buffered)
 
-			trade := Trade{
-				Ticker:    line[0],
-				Price:     price,
-				Amount:    count,
-				Timestamp: timestampData,
-			}
+	if err := writer.Write(candles); err != nil {
+		return err
+	}
 
-			select {
-			case resultFile <- trade:
-			case <-cntx.Done():
-				fmt.Println("Context terminated due to timeout")
-				return
-			}
-		}
-	}(tradesCSV)
+	if err := writer.Close(); err != nil {
+		return err
+	}
 
-	return resultFile, nil
+	return buffered.Flush()
 }
 
-func writeCSV(channelData <-chan []Candle, filename string) {
-	file, err := os.Create(filename)
+// outputWriters are the candle writers by output format, the format is the file extension.
+var outputWriters = map[string]func(candles []Candle, file io.Writer) error{
+	"csv":     writeCSV,
+	"parquet": writeParquet,
+}
 
+// writeFile creates the file and writes the candles to it in the format.
+func writeFile(candles []Candle, format, filename string) error {
+	file, err := os.Create(filename)
 	if err != nil {
-		log.Fatal(err)
+		return &stageError{stage: "write", err: err}
 	}
 
-	defer file.Close()
+	if err := outputWriters[format](candles, file); err != nil {
+		file.Close()
+		return &stageError{stage: "write " + filename, err: err}
+	}
 
-	for candles := range channelData {
-		if len(candles) == 0 {
-			continue
+	if err := file.Close(); err != nil {
+		return &stageError{stage: "write", err: err}
+	}
+
+	return nil
+}
+
+// writeResult collects the candles of every timeframe and writes them in the given
+// order. A cancelled pipeline still writes the candles finished before it stopped.
+func writeResult(group *pipelineGroup, dir, format string, order ordering,
+	timeframes []timeframe, candleChannels []<-chan []Candle) {
+	writeToFile := func(filename string, channelData <-chan []Candle) error {
+		var candles []Candle
+		for batch := range channelData {
+			candles = append(candles, batch...)
 		}
 
-		for _, candle := range candles {
-			str := candleFormat(candle)
+		sortCandles(candles, order)
+
+		if order != perTicker {
+			return writeFile(candles, format, filename+"."+format)
+		}
 
-			if _, err := file.WriteString(str); err != nil {
-				log.Fatal(err)
+		for _, tickerCandles := range splitByTicker(candles) {
+			err := writeFile(tickerCandles, format, filename+"_"+tickerFileName(tickerCandles[0].Ticker)+"."+format)
+			if err != nil {
+				return err
 			}
 		}
+
+		return nil
+	}
+
+	for i, frame := range timeframes {
+		filename, channelData := filepath.Join(dir, "candles_"+frame.label), candleChannels[i]
+		group.run(func() error { return writeToFile(filename, channelData) })
 	}
 }
 
-func writeResult(candles5minChan, candles30minChan, candles240minChan <-chan []Candle) {
-	var wg sync.WaitGroup
+// fanOutTrades copies every batch of trades to n channels, one per timeframe. The
+// batches are shared, the receivers must not change them.
+func fanOutTrades(cntx context.Context, group *pipelineGroup, tradeChannelData <-chan []Trade, n int) []<-chan []Trade {
+	channels := make([]chan []Trade, n)
+	outputs := make([]<-chan []Trade, n)
+
+	for i := range channels {
+		channels[i] = make(chan []Trade)
+		outputs[i] = channels[i]
+	}
+
+	group.run(func() error {
+		defer func() {
+			for _, channel := range channels {
+				close(channel)
+			}
+		}()
+
+		for batch := range tradeChannelData {
+			for _, channel := range channels {
+				select {
+				case channel <- batch:
+				case <-cntx.Done():
+					return nil
+				}
+			}
+		}
+
+		return nil
+	})
 
-	classesCnt := 3
+	return outputs
+}
+
+// gapPolicy tells what to do with buckets a ticker has no trades in.
+type gapPolicy int
+
+const (
+	// skipGaps writes no candle for an empty bucket.
+	skipGaps gapPolicy = iota
+	// fillGaps writes a flat candle at the previous close of the ticker in the session.
+	fillGaps
+)
 
-	wg.Add(classesCnt)
+func parseGapPolicy(name string) (gapPolicy, error) {
+	switch name {
+	case "skip":
+		return skipGaps, nil
+	case "fill":
+		return fillGaps, nil
+	default:
+		return skipGaps, fmt.Errorf("unknown gap policy %q, expected skip or fill", name)
+	}
+}
 
-	writeToFile := func(filename string, channelData <-chan []Candle) {
-		defer wg.Done()
-		writeCSV(channelData, filename)
+func flatCandle(ticker string, price decimal.Decimal, timestamp time.Time) Candle {
+	return Candle{
+		Ticker:       ticker,
+		Timestamp:    timestamp,
+		OpeningPrice: price,
+		MaxPrice:     price,
+		MinPrice:     price,
+		ClosingPrice: price,
 	}
+}
 
-	go writeToFile("candles_5m.csv", candles5minChan)
-	go writeToFile("candles_30m.csv", candles30minChan)
-	go writeToFile("candles_240m.csv", candles240minChan)
+// tickerCandles collects the trades of the current bucket of a ticker. Buckets start
+// at the open of the ticker's trading session and are interval long.
+type tickerCandles struct {
+	session calendar.Session
+	bucket  time.Time
+	// candle is the candle of the bucket so far, its VWAP is set once it is finished.
+	candle Candle
+}
 
-	wg.Wait()
+// aggregator builds the candles of an interval. Tickers are aggregated independently,
+// so the trades can be split among aggregators by ticker.
+type aggregator struct {
+	interval        time.Duration
+	tradingCalendar *calendar.Calendar
+	gaps            gapPolicy
+	tickers         map[string]*tickerCandles
+	// candles are the finished candles, see take.
+	candles []Candle
+	outside int
+	late    int
 }
 
-func groupTradesByTimestampInterval(tradeChannelData <-chan Trade) (<-chan Trade, <-chan Trade, <-chan Trade) {
-	trade5minData := make(chan Trade)
-	trade30minData := make(chan Trade)
-	trade240minData := make(chan Trade)
+func newAggregator(interval time.Duration, tradingCalendar *calendar.Calendar, gaps gapPolicy) *aggregator {
+	return &aggregator{
+		interval:        interval,
+		tradingCalendar: tradingCalendar,
+		gaps:            gaps,
+		tickers:         make(map[string]*tickerCandles),
+	}
+}
+
+// add adds the trade to the candle of its bucket. A trade that would overflow the
+// candle is returned as *rangeError and left out.
+func (a *aggregator) add(trade Trade) error {
+	current, ok := a.tickers[trade.Ticker]
+
+	// Sessions don't overlap, so most trades fall in the session of the ticker's previous
+	// trade and need no calendar lookup.
+	var session calendar.Session
+
+	open := ok && current.session.Contains(trade.Timestamp)
+	if open {
+		session = current.session
+	} else {
+		session, open = a.tradingCalendar.Session(trade.Ticker, trade.Timestamp)
+	}
+
+	if !open {
+		a.outside++
+		return nil
+	}
+
+	bucket := session.Open.Add(trade.Timestamp.Sub(session.Open) / a.interval * a.interval)
+
+	if ok && bucket.Before(current.bucket) {
+		// The candle of a late trade has already been finished.
+		a.late++
+		return nil
+	}
+
+	// Add the trade to a copy of the candle it goes to, so a trade that overflows it
+	// leaves every candle as it was.
+	next := Candle{
+		Ticker:       trade.Ticker,
+		Timestamp:    bucket,
+		OpeningPrice: trade.Price,
+		MaxPrice:     trade.Price,
+		MinPrice:     trade.Price,
+	}
+	if ok && current.session.Open.Equal(session.Open) && bucket.Equal(current.bucket) {
+		next = current.candle
+	}
+
+	if err := next.AddTrade(trade); err != nil {
+		return &rangeError{trade: trade, interval: a.interval, err: err}
+	}
+
+	if trade.Price.GreaterThan(next.MaxPrice) {
+		next.MaxPrice = trade.Price
+	}
 
-	go func(<-chan Trade, <-chan Trade, <-chan Trade) {
-		defer close(trade5minData)
-		defer close(trade30minData)
-		defer close(trade240minData)
+	if trade.Price.LessThan(next.MinPrice) {
+		next.MinPrice = trade.Price
+	}
 
-		for tradeVal := range tradeChannelData {
-			trade5minData <- tradeVal
-			trade30minData <- tradeVal
-			trade240minData <- tradeVal
+	next.ClosingPrice = trade.Price
+
+	switch {
+	case !ok:
+		current = &tickerCandles{session: session, bucket: bucket}
+		a.tickers[trade.Ticker] = current
+	case !current.session.Open.Equal(session.Open):
+		// Gaps are not filled across sessions.
+		if err := a.flush(current); err != nil {
+			return err
 		}
-	}(trade5minData, trade30minData, trade240minData)
 
-	return trade5minData, trade30minData, trade240minData
-}
+		current.session, current.bucket = session, bucket
+	case bucket.After(current.bucket):
+		price := current.candle.ClosingPrice
+		if err := a.flush(current); err != nil {
+			return err
+		}
 
-func computeCandleFromTrade(trades []Trade, timestamp time.Time) Candle {
-	candle := Candle{
-		Ticker:       trades[0].Ticker,
-		OpeningPrice: trades[0].Price,
-		MaxPrice:     getMaxCandlePrice(trades),
-		MinPrice:     getMinCandlePrice(trades),
-		ClosingPrice: trades[len(trades)-1].Price,
-		Timestamp:    timestamp,
+		if a.gaps == fillGaps {
+			for empty := current.bucket.Add(a.interval); empty.Before(bucket); empty = empty.Add(a.interval) {
+				a.candles = append(a.candles, flatCandle(trade.Ticker, price, empty))
+			}
+		}
+
+		current.bucket = bucket
 	}
 
-	return candle
+	current.candle = next
+
+	return nil
 }
 
-func createCandles(tickers map[string][]Trade, start time.Time) []Candle {
-	var candle Candle
+func (a *aggregator) flush(current *tickerCandles) error {
+	c := current.candle
+	if c.Volume != 0 {
+		vwap, err := c.Turnover.Div(decimal.FromInt(c.Volume))
+		if err != nil {
+			return err
+		}
 
-	var candles []Candle
+		c.VWAP = vwap
+	}
 
-	for _, tradeVal := range tickers {
-		candle = computeCandleFromTrade(tradeVal, start)
-		candles = append(candles, candle)
+	a.candles = append(a.candles, c)
+
+	return nil
+}
+
+// finish finishes the candles of the last buckets.
+func (a *aggregator) finish() error {
+	for _, current := range a.tickers {
+		if err := a.flush(current); err != nil {
+			return err
+		}
 	}
 
-	sort.Slice(candles, func(lhs, rhs int) bool {
-		return candles[lhs].MinPrice < candles[rhs].MinPrice
-	})
+	a.tickers = make(map[string]*tickerCandles)
+
+	return nil
+}
+
+// take returns the candles finished since the last call.
+func (a *aggregator) take() []Candle {
+	candles := a.candles
+	a.candles = nil
 
 	return candles
 }
 
-func createCandleFromTradeWithInterval(tradeDataChannel <-chan Trade, candleDataChannel chan []Candle, interval time.Duration) {
-	tickers := make(map[string][]Trade)
+func reportSkipped(interval time.Duration, aggregators []*aggregator) {
+	outside, late := 0, 0
+	for _, a := range aggregators {
+		outside += a.outside
+		late += a.late
+	}
 
-	var ts time.Time
+	if outside > 0 {
+		log.Printf("%s candles: skipped %d trades outside trading sessions", interval, outside)
+	}
 
-	var err error
+	if late > 0 {
+		log.Printf("%s candles: skipped %d trades older than the current candle", interval, late)
+	}
+}
 
-	for trade := range tradeDataChannel {
-		if trade.Timestamp.Hour() < 7 && trade.Timestamp.Hour() >= 3 {
-			candles := createCandles(tickers, ts)
+// runAggregators feeds the trades to the aggregators and sends the finished candles of
+// aggregators[i] to candleChannels[i]. Trades that overflow their candle go to the
+// error policy. When the pipeline is cancelled the unfinished candles are dropped. The
+// writers read until the channels are closed, so the sends don't need to watch the
+// context.
+func runAggregators(cntx context.Context, tradeChannelData <-chan []Trade, aggregators []*aggregator,
+	candleChannels []chan []Candle, errs *tradeErrors) error {
+	send := func() {
+		for i, a := range aggregators {
+			if candles := a.take(); len(candles) > 0 {
+				candleChannels[i] <- candles
+			}
+		}
+	}
 
-			day := strings.Split(trade.Timestamp.String(), " ")[0]
+	for batch := range tradeChannelData {
+		for _, a := range aggregators {
+			for _, trade := range batch {
+				err := a.add(trade)
+				if err == nil {
+					continue
+				}
+
+				var rangeErr *rangeError
+				if errors.As(err, &rangeErr) {
+					err = errs.addRange(rangeErr)
+				}
+
+				if err != nil {
+					return &stageError{stage: fmt.Sprintf("aggregate %s", a.interval), err: err}
+				}
+			}
+		}
 
-			ts, err = time.Parse(time.RFC3339, day+"T07:00:00Z")
+		send()
+	}
 
-			if err != nil {
-				fmt.Println("can`t parse the time: ", err)
+	if cntx.Err() == nil {
+		for _, a := range aggregators {
+			if err := a.finish(); err != nil {
+				return &stageError{stage: fmt.Sprintf("aggregate %s", a.interval), err: err}
 			}
+		}
+	}
 
-			candleDataChannel <- candles
+	send()
 
-			tickers = map[string][]Trade{}
+	return nil
+}
 
-			continue
-		}
+// getCandlesWithIntervals aggregates the trades with a goroutine per timeframe or, with
+// a trade channel per worker, with workers that each take the share of the tickers on
+// their channel.
+func getCandlesWithIntervals(cntx context.Context, group *pipelineGroup, tradeChannels []<-chan []Trade,
+	timeframes []timeframe, tradingCalendar *calendar.Calendar, gaps gapPolicy, errs *tradeErrors) []<-chan []Candle {
+	candleChannels := make([]chan []Candle, len(timeframes))
+	outputs := make([]<-chan []Candle, len(timeframes))
+
+	for i := range candleChannels {
+		candleChannels[i] = make(chan []Candle)
+		outputs[i] = candleChannels[i]
+	}
+
+	// byTimeframe are the aggregators of every timeframe, to sum up what they skipped.
+	byTimeframe := make([][]*aggregator, len(timeframes))
 
-		if ts.Add(interval).Before(trade.Timestamp) {
-			candles := createCandles(tickers, ts)
-			candleDataChannel <- candles
+	var wg sync.WaitGroup
 
-			tickers = map[string][]Trade{}
+	run := func(trades <-chan []Trade, aggregators []*aggregator, channels []chan []Candle) {
+		wg.Add(1)
+		group.run(func() error {
+			defer wg.Done()
 
-			ts = ts.Add(interval)
+			return runAggregators(cntx, trades, aggregators, channels, errs)
+		})
+	}
+
+	if len(tradeChannels) > 1 {
+		for _, shard := range tradeChannels {
+			aggregators := make([]*aggregator, len(timeframes))
+			for i, frame := range timeframes {
+				aggregators[i] = newAggregator(frame.interval, tradingCalendar, gaps)
+				byTimeframe[i] = append(byTimeframe[i], aggregators[i])
+			}
+
+			run(shard, aggregators, candleChannels)
 		}
+	} else {
+		for i, trades := range fanOutTrades(cntx, group, tradeChannels[0], len(timeframes)) {
+			a := newAggregator(timeframes[i].interval, tradingCalendar, gaps)
+			byTimeframe[i] = []*aggregator{a}
 
-		tickers[trade.Ticker] = append(tickers[trade.Ticker], trade)
+			run(trades, byTimeframe[i], candleChannels[i:i+1])
+		}
 	}
 
-	candles := createCandles(tickers, ts)
-	candleDataChannel <- candles
+	group.run(func() error {
+		wg.Wait()
+
+		for i, frame := range timeframes {
+			reportSkipped(frame.interval, byTimeframe[i])
+			close(candleChannels[i])
+		}
+
+		return nil
+	})
+
+	return outputs
 }
 
-func getCandlesWithIntervals(tradeChannelData5min, tradeChannelData30min, tradeChannelData240min <-chan Trade) (<-chan []Candle, <-chan []Candle, <-chan []Candle) {
-	candles5minChan := make(chan []Candle)
-	candles30minChan := make(chan []Candle)
-	candles240minChan := make(chan []Candle)
+// pipelineOptions configure runPipeline, see the flags of main.
+type pipelineOptions struct {
+	filename   string
+	from       time.Time
+	to         time.Time
+	format     string
+	order      ordering
+	timeframes []timeframe
+	calendar   *calendar.Calendar
+	gaps       gapPolicy
+	workers    int
+	errs       *tradeErrors
+	// dir is where the candle files go, the working directory when empty.
+	dir string
+}
+
+// runPipeline reads the trades and writes the candles of every timeframe. It returns
+// once every stage has, with the first error of a stage.
+func runPipeline(cntx context.Context, options pipelineOptions) error {
+	start := make(chan struct{})
+	group, cntx := newPipelineGroup(cntx)
+
+	fileReadingChans, err := readFileConcurrently(cntx, group, options.filename, options.from, options.to,
+		options.workers, options.errs, start)
+	if err != nil {
+		group.cancel()
+		options.errs.close()
 
-	constructCandle := func(tradeChannelData <-chan Trade, candleChannelData chan []Candle, interval time.Duration) {
-		defer close(candleChannelData)
-		createCandleFromTradeWithInterval(tradeChannelData, candleChannelData, interval)
+		return fmt.Errorf("can`t read file: %s", err)
 	}
 
-	go constructCandle(tradeChannelData5min, candles5minChan, 5*time.Minute)       //nolint
-	go constructCandle(tradeChannelData30min, candles30minChan, 30*time.Minute)    //nolint
-	go constructCandle(tradeChannelData240min, candles240minChan, 240*time.Minute) //nolint
+	start <- struct{}{}
+
+	candleChannels := getCandlesWithIntervals(cntx, group, fileReadingChans, options.timeframes, options.calendar,
+		options.gaps, options.errs)
+
+	writeResult(group, options.dir, options.format, options.order, options.timeframes, candleChannels)
+
+	err = group.wait()
+	if closeErr := options.errs.close(); err == nil && closeErr != nil {
+		err = &stageError{stage: "dead letter", err: closeErr}
+	}
 
-	return candles5minChan, candles30minChan, candles240minChan
+	return err
 }
 
-func createPipeline(fileReadingChan <-chan Trade) {
-	candles5min, candles30min, candles240min := groupTradesByTimestampInterval(fileReadingChan)
-	candles5minChan, candles30minChan, candles240minChan := getCandlesWithIntervals(candles5min, candles30min, candles240min)
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
 
-	writeResult(candles5minChan, candles30minChan, candles240minChan)
+	return time.Parse(time.RFC3339, value)
 }
 
-func main() {
-	start := make(chan struct{})
+// cancelOnSignal cancels the context on SIGINT or SIGTERM. Another signal after that
+// kills the process as usual.
+func cancelOnSignal(cntx context.Context) (context.Context, context.CancelFunc) {
+	cntx, cancel := context.WithCancel(cntx)
 
-	waitTime := 5 * time.Second //nolint
-	cntx, finish := context.WithTimeout(context.Background(), waitTime)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
 
-	defer finish()
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-cntx.Done():
+		}
+
+		signal.Stop(signals)
+	}()
 
-	var filename string
+	return cntx, cancel
+}
 
-	flag.StringVar(&filename, "file", "", "")
+func main() {
+	var waitTime time.Duration
+
+	var filename, fromFlag, toFlag, format, calendarFile, timeframesFlag, gapsFlag, orderFlag string
+	var errorsFlag, deadLetterFile string
+
+	var workers int
+
+	flag.StringVar(&filename, "file", "", "trades input file, CSV or columnar")
+	flag.StringVar(&fromFlag, "from", "", "skip trades before this RFC3339 time")
+	flag.StringVar(&toFlag, "to", "", "skip trades at or after this RFC3339 time")
+	flag.StringVar(&format, "format", "csv", "candles output format: csv or parquet")
+	flag.StringVar(&timeframesFlag, "timeframes", "5m,30m,240m",
+		"comma-separated candle intervals like 30s, 15m, 1h or 1d, each written to candles_<interval>.<format>")
+	flag.StringVar(&orderFlag, "order", "ticker-time",
+		"candles order: ticker-time, time-ticker, or per-ticker for a file per ticker")
+	flag.StringVar(&gapsFlag, "gaps", "skip",
+		"candles for intervals a ticker did not trade in: skip, or fill with flat candles at the previous close")
+	flag.StringVar(&errorsFlag, "errors", "skip",
+		"malformed trades: fail to stop at the first one, skip, or dead-letter to write them to -dead-letter")
+	flag.StringVar(&deadLetterFile, "dead-letter", "dead_letter.csv", "file for malformed trades with -errors dead-letter")
+	flag.IntVar(&workers, "workers", 1,
+		"aggregate with this many workers, each taking a share of the tickers; 1 runs a goroutine per timeframe")
+	flag.DurationVar(&waitTime, "timeout", 5*time.Second, //nolint
+		"stop after this long and write the candles finished so far, 0 for no limit")
+	flag.StringVar(&calendarFile, "calendar", "",
+		"trading calendar JSON file, by default every day trades from 07:00 to 03:00 UTC")
 	flag.Parse()
 
-	fileReadingChan, err := readFileConcurrently(cntx, filename, start)
+	if _, ok := outputWriters[format]; !ok {
+		log.Fatalf("unknown format %q, expected csv or parquet", format)
+	}
+
+	timeframes, err := parseTimeframes(timeframesFlag)
 	if err != nil {
-		log.Fatal("can`t read file: ", err)
+		log.Fatal("bad -timeframes: ", err)
 	}
 
-	start <- struct{}{}
+	gaps, err := parseGapPolicy(gapsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	order, err := parseOrdering(orderFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	policy, err := parseErrorPolicy(errorsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if workers < 1 {
+		log.Fatalf("bad -workers %d, expected at least 1", workers)
+	}
+
+	from, err := parseTime(fromFlag)
+	if err != nil {
+		log.Fatal("bad -from: ", err)
+	}
 
-	createPipeline(fileReadingChan)
+	to, err := parseTime(toFlag)
+	if err != nil {
+		log.Fatal("bad -to: ", err)
+	}
+
+	tradingCalendar := calendar.Default()
+	if calendarFile != "" {
+		if tradingCalendar, err = calendar.Load(calendarFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	errs, err := newTradeErrors(policy, deadLetterFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cntx, finish := context.Background(), context.CancelFunc(func() {})
+	if waitTime > 0 {
+		cntx, finish = context.WithTimeout(cntx, waitTime)
+	}
+
+	defer finish()
+
+	timeout := cntx
+	cntx, stop := cancelOnSignal(cntx)
+	interrupted := cntx
+
+	defer stop()
+
+	err = runPipeline(cntx, pipelineOptions{
+		filename:   filename,
+		from:       from,
+		to:         to,
+		format:     format,
+		order:      order,
+		timeframes: timeframes,
+		calendar:   tradingCalendar,
+		gaps:       gaps,
+		workers:    workers,
+		errs:       errs,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The pipeline was stopped when the timeout or a signal cancelled it.
+	switch {
+	case timeout.Err() != nil:
+		log.Fatalf("timed out after %s, wrote the candles finished so far", waitTime)
+	case interrupted.Err() != nil:
+		log.Println("interrupted, wrote the candles finished so far")
+		os.Exit(130) //nolint
+	}
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ordering is how candles are ordered in the output files.
+type ordering int
+
+const (
+	// byTickerTime writes all candles of a ticker before the next ticker's.
+	byTickerTime ordering = iota
+	// byTimeTicker writes the candles bucket by bucket, by ticker within a bucket.
+	byTimeTicker
+	// perTicker writes a file per ticker with its candles by time.
+	perTicker
+)
+
+func parseOrdering(name string) (ordering, error) {
+	switch name {
+	case "ticker-time":
+		return byTickerTime, nil
+	case "time-ticker":
+		return byTimeTicker, nil
+	case "per-ticker":
+		return perTicker, nil
+	default:
+		return byTickerTime, fmt.Errorf("unknown order %q, expected ticker-time, time-ticker or per-ticker", name)
+	}
+}
+
+func sortCandles(candles []Candle, order ordering) {
+	sort.Slice(candles, func(i, j int) bool {
+		lhs, rhs := &candles[i], &candles[j]
+
+		if order == byTimeTicker && !lhs.Timestamp.Equal(rhs.Timestamp) {
+			return lhs.Timestamp.Before(rhs.Timestamp)
+		}
+
+		if lhs.Ticker != rhs.Ticker {
+			return lhs.Ticker < rhs.Ticker
+		}
+
+		return lhs.Timestamp.Before(rhs.Timestamp)
+	})
+}
+
+// splitByTicker cuts candles sorted by ticker into a slice per ticker.
+func splitByTicker(candles []Candle) [][]Candle {
+	var groups [][]Candle
+
+	for start := 0; start < len(candles); {
+		end := start + 1
+		for end < len(candles) && candles[end].Ticker == candles[start].Ticker {
+			end++
+		}
+
+		groups = append(groups, candles[start:end])
+		start = end
+	}
+
+	return groups
+}
+
+// tickerFileName keeps path separators in a ticker out of the file name.
+func tickerFileName(ticker string) string {
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(ticker)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/calendar"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// testOptions are the defaults of main for the trades in filename, writing to dir.
+func testOptions(t testing.TB, filename, dir string) pipelineOptions {
+	t.Helper()
+
+	timeframes, err := parseTimeframes("5m,30m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, err := newTradeErrors(failFast, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pipelineOptions{
+		filename:   filename,
+		format:     "csv",
+		timeframes: timeframes,
+		calendar:   calendar.Default(),
+		workers:    1,
+		errs:       errs,
+		dir:        dir,
+	}
+}
+
+// writeTrades writes the trades of writeTradeRows to filename.
+func writeTrades(t testing.TB, filename string, n, malformed int) {
+	t.Helper()
+
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeTradeRows(file, n, malformed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTradeRows writes n trades of a hundred tickers, one every 10ms from 07:00. Half
+// of the tickers pause every other ten minutes, which leaves gaps in their candles. The
+// trade at malformed, if any, has a bad price.
+func writeTradeRows(out io.Writer, n, malformed int) error {
+	w := bufio.NewWriter(out)
+	start := time.Date(2019, 1, 30, 7, 0, 0, 0, time.UTC)
+
+	for i := 0; i < n; i++ {
+		price := strconv.Itoa(100+i%50) + "." + strconv.Itoa(10+i%90)
+		if i == malformed {
+			price = "x"
+		}
+
+		ticker := i % 100
+		if ticker >= 50 && (i/60000)%2 == 1 {
+			ticker -= 50
+		}
+
+		at := start.Add(time.Duration(i) * 10 * time.Millisecond)
+		fmt.Fprintf(w, "T%02d,%s,%d,%s\n", ticker, price, 1+i%30, at.Format(candle.TradeTimeLayout))
+	}
+
+	return w.Flush()
+}
+
+// readDir returns the contents of the files in dir by name.
+func readDir(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string][]byte)
+
+	for _, entry := range entries {
+		data, err := ioutil.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files[entry.Name()] = data
+	}
+
+	return files
+}
+
+func fileNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func equalDirs(t *testing.T, got, want map[string][]byte) {
+	t.Helper()
+
+	if gotNames, wantNames := fileNames(got), fileNames(want); len(gotNames) != len(wantNames) {
+		t.Fatalf("wrote %v, want %v", gotNames, wantNames)
+	}
+
+	for name, data := range want {
+		if !bytes.Equal(got[name], data) {
+			t.Errorf("%s differs:\n%s\nwant:\n%s", name, got[name], data)
+		}
+	}
+}
+
+// TestGolden checks the output of every order byte for byte against testdata/golden.
+func TestGolden(t *testing.T) {
+	for _, name := range []string{"ticker-time", "time-ticker", "per-ticker"} {
+		t.Run(name, func(t *testing.T) {
+			order, err := parseOrdering(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dir := t.TempDir()
+			options := testOptions(t, filepath.Join("testdata", "trades.csv"), dir)
+			options.order = order
+
+			if err := runPipeline(context.Background(), options); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", "golden", name)
+
+			if *update {
+				if err := os.RemoveAll(golden); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.MkdirAll(golden, 0o755); err != nil { //nolint
+					t.Fatal(err)
+				}
+
+				for file, data := range readDir(t, dir) {
+					if err := ioutil.WriteFile(filepath.Join(golden, file), data, 0o644); err != nil { //nolint
+						t.Fatal(err)
+					}
+				}
+			}
+
+			equalDirs(t, readDir(t, dir), readDir(t, golden))
+		})
+	}
+}
+
+// TestGoldenWorkers checks that sharding among workers gives the same files.
+func TestGoldenWorkers(t *testing.T) {
+	for _, workers := range []int{2, 3, 8} {
+		dir := t.TempDir()
+		options := testOptions(t, filepath.Join("testdata", "trades.csv"), dir)
+		options.workers = workers
+
+		if err := runPipeline(context.Background(), options); err != nil {
+			t.Fatal(err)
+		}
+
+		equalDirs(t, readDir(t, dir), readDir(t, filepath.Join("testdata", "golden", "ticker-time")))
+	}
+}
+
+// TestOverflow feeds two trades whose turnover only overflows together to every error
+// policy.
+func TestOverflow(t *testing.T) {
+	for name, policy := range map[string]errorPolicy{"fail": failFast, "skip": skipErrors, "dead-letter": deadLetter} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			trades := filepath.Join(dir, "trades.csv")
+
+			data := "AAPL,9000000,1000000,2019-01-30 07:00:01.000000\nAAPL,9000000,1000000,2019-01-30 07:00:02.000000\n"
+			if err := ioutil.WriteFile(trades, []byte(data), 0o644); err != nil { //nolint
+				t.Fatal(err)
+			}
+
+			out := filepath.Join(dir, "out")
+			if err := os.Mkdir(out, 0o755); err != nil { //nolint
+				t.Fatal(err)
+			}
+
+			options := testOptions(t, trades, out)
+
+			deadLetterFile := filepath.Join(dir, "dead_letter.csv")
+
+			errs, err := newTradeErrors(policy, deadLetterFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			options.errs = errs
+
+			err = runPipeline(context.Background(), options)
+
+			if policy == failFast {
+				var rangeErr *rangeError
+				if !errors.As(err, &rangeErr) || !errors.Is(err, decimal.ErrRange) {
+					t.Fatalf("got error %v, want a range error", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The first trade makes the candle, the second is left out.
+			want := "AAPL,2019-01-30T07:00:00Z,9000000,9000000,9000000,9000000,1000000,9000000000000,1,9000000\n"
+			for _, name := range []string{"candles_5m.csv", "candles_30m.csv"} {
+				got, err := ioutil.ReadFile(filepath.Join(out, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if string(got) != want {
+					t.Errorf("%s: got %q, want %q", name, got, want)
+				}
+			}
+
+			if policy != deadLetter {
+				return
+			}
+
+			got, err := ioutil.ReadFile(deadLetterFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// A row for each timeframe the trade overflows.
+			if rows := bytes.Count(got, []byte("AAPL,9000000,1000000,2019-01-30 07:00:02,,")); rows != 2 {
+				t.Errorf("got %d dead-letter rows in:\n%s", rows, got)
+			}
+		})
+	}
+}
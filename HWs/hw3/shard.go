@@ -0,0 +1,38 @@
+package main
+
+import (
+	"hash/fnv"
+)
+
+// tradeShards splits the trades among the workers by a hash of the ticker, so all trades
+// of a ticker go to the same worker in their original order.
+type tradeShards struct {
+	workers int
+	shards  map[string]int
+}
+
+func newTradeShards(workers int) *tradeShards {
+	return &tradeShards{workers: workers, shards: make(map[string]int)}
+}
+
+// of returns the worker of the ticker, hashing each ticker once.
+func (s *tradeShards) of(ticker string) int {
+	if s.workers == 1 {
+		return 0
+	}
+
+	shard, ok := s.shards[ticker]
+	if !ok {
+		shard = shardOf(ticker, s.workers)
+		s.shards[ticker] = shard
+	}
+
+	return shard
+}
+
+func shardOf(ticker string, workers int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(ticker)) //nolint
+
+	return int(hash.Sum32() % uint32(workers))
+}
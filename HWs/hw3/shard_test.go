@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestWorkersOutput checks that the workers write the same files as the sequential
+// pipeline, with and without filled gaps.
+func TestWorkersOutput(t *testing.T) {
+	trades := filepath.Join(t.TempDir(), "trades.csv")
+	writeTrades(t, trades, 200000, -1)
+
+	for _, gaps := range []gapPolicy{skipGaps, fillGaps} {
+		run := func(workers int) map[string][]byte {
+			dir := t.TempDir()
+
+			options := testOptions(t, trades, dir)
+			options.workers = workers
+			options.gaps = gaps
+
+			if err := runPipeline(context.Background(), options); err != nil {
+				t.Fatal(err)
+			}
+
+			return readDir(t, dir)
+		}
+
+		sequential := run(1)
+
+		for _, workers := range []int{2, 5, 16} {
+			equalDirs(t, run(workers), sequential)
+		}
+	}
+}
+
+// BenchmarkPipeline compares the sequential pipeline with workers on three million
+// trades of a hundred tickers, with the default timeframes of main.
+func BenchmarkPipeline(b *testing.B) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	trades := filepath.Join(b.TempDir(), "trades.csv")
+	writeTrades(b, trades, 3000000, -1)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			timeframes, err := parseTimeframes("5m,30m,240m")
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			options := testOptions(b, trades, b.TempDir())
+			options.timeframes = timeframes
+			options.workers = workers
+
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if err := runPipeline(context.Background(), options); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeframe is a candle interval and the label its output file is named after.
+type timeframe struct {
+	label    string
+	interval time.Duration
+}
+
+// parseInterval accepts Go durations like 30s, 15m or 4h, and days like 1d.
+func parseInterval(value string) (time.Duration, error) {
+	if days := strings.TrimSuffix(value, "d"); days != value {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("bad interval %q", value)
+		}
+
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("bad interval %q", value)
+	}
+
+	return interval, nil
+}
+
+// parseTimeframes reads a comma-separated list of intervals, e.g. "5m,30m,240m".
+func parseTimeframes(value string) ([]timeframe, error) {
+	var timeframes []timeframe
+
+	labels := make(map[string]bool)
+
+	for _, label := range strings.Split(value, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" {
+			continue
+		}
+
+		interval, err := parseInterval(label)
+		if err != nil {
+			return nil, err
+		}
+
+		if interval <= 0 {
+			return nil, fmt.Errorf("interval %q must be positive", label)
+		}
+
+		if labels[label] {
+			return nil, fmt.Errorf("interval %q is listed twice", label)
+		}
+
+		labels[label] = true
+		timeframes = append(timeframes, timeframe{label: label, interval: interval})
+	}
+
+	if len(timeframes) == 0 {
+		return nil, fmt.Errorf("no intervals in %q", value)
+	}
+
+	return timeframes, nil
+}
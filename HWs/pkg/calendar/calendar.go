@@ -0,0 +1,272 @@
+// Package calendar tells the trading sessions of exchanges: their daily open and close
+// times in the exchange time zone, weekends, holidays and half-days.
+//
+// A calendar is loaded from a JSON file, e.g.
+//
+//	{
+//	  "default": "SPB",
+//	  "tickers": {"SBER": "MOEX"},
+//	  "exchanges": {
+//	    "MOEX": {
+//	      "timezone": "Europe/Moscow", "open": "10:00", "close": "18:45",
+//	      "weekends": ["Saturday", "Sunday"],
+//	      "holidays": ["2019-01-01"],
+//	      "half_days": [{"date": "2019-12-31", "close": "14:00"}]
+//	    },
+//	    "SPB": {"timezone": "Europe/Moscow", "open": "10:00", "close": "03:00"}
+//	  }
+//	}
+//
+// Tickers missing from "tickers" trade on the "default" exchange. A close at or before
+// the open ends the session on the next day, the session belongs to the day it opens.
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Session is a trading session, from Open inclusive to Close exclusive, in UTC.
+type Session struct {
+	Open  time.Time
+	Close time.Time
+}
+
+func (s Session) Contains(t time.Time) bool {
+	return !t.Before(s.Open) && t.Before(s.Close)
+}
+
+// clock is a time of day, the hour may be 24 for midnight at the end of the day.
+type clock struct {
+	hour   int
+	minute int
+}
+
+func parseClock(value string) (clock, error) {
+	t, err := time.Parse("15:04", value)
+	if err == nil {
+		return clock{hour: t.Hour(), minute: t.Minute()}, nil
+	}
+
+	if value == "24:00" {
+		return clock{hour: 24}, nil
+	}
+
+	return clock{}, fmt.Errorf("bad time of day %q, expected HH:MM", value)
+}
+
+func (c clock) minutes() int {
+	return c.hour*60 + c.minute
+}
+
+// Exchange is the trading schedule of an exchange.
+type Exchange struct {
+	Name     string
+	location *time.Location
+	open     clock
+	close    clock
+	weekends map[time.Weekday]bool
+	holidays map[string]bool
+	halfDays map[string]clock
+}
+
+func (e *Exchange) at(year int, month time.Month, day int, c clock) time.Time {
+	return time.Date(year, month, day, c.hour, c.minute, 0, 0, e.location)
+}
+
+// sessionOn returns the session that opens on the given local date, if it is a trading day.
+func (e *Exchange) sessionOn(date time.Time) (Session, bool) {
+	key := date.Format(dateLayout)
+	if e.weekends[date.Weekday()] || e.holidays[key] {
+		return Session{}, false
+	}
+
+	closeAt := e.close
+	if halfDay, ok := e.halfDays[key]; ok {
+		closeAt = halfDay
+	}
+
+	year, month, day := date.Date()
+	open := e.at(year, month, day, e.open)
+
+	if closeAt.minutes() <= e.open.minutes() {
+		day++
+	}
+
+	return Session{Open: open.UTC(), Close: e.at(year, month, day, closeAt).UTC()}, true
+}
+
+// Session returns the session t falls in, false when the exchange is closed at t.
+func (e *Exchange) Session(t time.Time) (Session, bool) {
+	local := t.In(e.location)
+	year, month, day := local.Date()
+
+	// An overnight session that opened the day before may still be running.
+	for _, date := range []time.Time{
+		time.Date(year, month, day, 0, 0, 0, 0, e.location),
+		time.Date(year, month, day-1, 0, 0, 0, 0, e.location),
+	} {
+		if session, ok := e.sessionOn(date); ok && session.Contains(t) {
+			return session, true
+		}
+	}
+
+	return Session{}, false
+}
+
+// Calendar maps tickers to exchanges.
+type Calendar struct {
+	exchanges map[string]*Exchange
+	tickers   map[string]string
+	fallback  string
+}
+
+// Exchange returns the exchange the ticker trades on.
+func (c *Calendar) Exchange(ticker string) *Exchange {
+	if name, ok := c.tickers[ticker]; ok {
+		return c.exchanges[name]
+	}
+
+	return c.exchanges[c.fallback]
+}
+
+// Session returns the session of the ticker's exchange t falls in, false when the
+// exchange is closed at t.
+func (c *Calendar) Session(ticker string, t time.Time) (Session, bool) {
+	return c.Exchange(ticker).Session(t)
+}
+
+// Default is the calendar hw3 used before calendars were configurable: every day is
+// a trading day with a session from 07:00 to 03:00 UTC.
+func Default() *Calendar {
+	exchange := &Exchange{
+		Name:     "default",
+		location: time.UTC,
+		open:     clock{hour: 7},
+		close:    clock{hour: 3},
+	}
+
+	return &Calendar{exchanges: map[string]*Exchange{exchange.Name: exchange}, fallback: exchange.Name}
+}
+
+type halfDayConfig struct {
+	Date  string `json:"date"`
+	Close string `json:"close"`
+}
+
+type exchangeConfig struct {
+	Timezone string          `json:"timezone"`
+	Open     string          `json:"open"`
+	Close    string          `json:"close"`
+	Weekends []string        `json:"weekends"`
+	Holidays []string        `json:"holidays"`
+	HalfDays []halfDayConfig `json:"half_days"`
+}
+
+type calendarConfig struct {
+	Default   string                    `json:"default"`
+	Tickers   map[string]string         `json:"tickers"`
+	Exchanges map[string]exchangeConfig `json:"exchanges"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+func newExchange(name string, cfg exchangeConfig) (*Exchange, error) {
+	exchange := &Exchange{
+		Name:     name,
+		location: time.UTC,
+		weekends: make(map[time.Weekday]bool),
+		holidays: make(map[string]bool),
+		halfDays: make(map[string]clock),
+	}
+
+	var err error
+
+	if cfg.Timezone != "" {
+		if exchange.location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	if exchange.open, err = parseClock(cfg.Open); err != nil {
+		return nil, fmt.Errorf("open: %s", err)
+	}
+
+	if exchange.close, err = parseClock(cfg.Close); err != nil {
+		return nil, fmt.Errorf("close: %s", err)
+	}
+
+	for _, name := range cfg.Weekends {
+		weekday, ok := weekdays[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown weekday %q", name)
+		}
+
+		exchange.weekends[weekday] = true
+	}
+
+	for _, date := range cfg.Holidays {
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return nil, fmt.Errorf("bad holiday %q, expected YYYY-MM-DD", date)
+		}
+
+		exchange.holidays[date] = true
+	}
+
+	for _, halfDay := range cfg.HalfDays {
+		if _, err := time.Parse(dateLayout, halfDay.Date); err != nil {
+			return nil, fmt.Errorf("bad half-day %q, expected YYYY-MM-DD", halfDay.Date)
+		}
+
+		if exchange.halfDays[halfDay.Date], err = parseClock(halfDay.Close); err != nil {
+			return nil, fmt.Errorf("half-day %s close: %s", halfDay.Date, err)
+		}
+	}
+
+	return exchange, nil
+}
+
+func Load(filename string) (*Calendar, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("can't read calendar: %s", err)
+	}
+
+	var cfg calendarConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("can't parse calendar %s: %s", filename, err)
+	}
+
+	c := &Calendar{exchanges: make(map[string]*Exchange), tickers: cfg.Tickers, fallback: cfg.Default}
+
+	for name, exchangeCfg := range cfg.Exchanges {
+		if c.exchanges[name], err = newExchange(name, exchangeCfg); err != nil {
+			return nil, fmt.Errorf("calendar %s: exchange %s: %s", filename, name, err)
+		}
+	}
+
+	if _, ok := c.exchanges[c.fallback]; !ok {
+		return nil, fmt.Errorf("calendar %s: default exchange %q is not defined", filename, c.fallback)
+	}
+
+	for ticker, name := range c.tickers {
+		if _, ok := c.exchanges[name]; !ok {
+			return nil, fmt.Errorf("calendar %s: ticker %s trades on undefined exchange %q", filename, ticker, name)
+		}
+	}
+
+	return c, nil
+}
@@ -0,0 +1,166 @@
+package calendar
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "time/tzdata" // the tests don't depend on the zoneinfo of the machine
+)
+
+// testCalendar has NYSE in New York, which changes to daylight saving time on 2019-03-10
+// and back on 2019-11-03, and CME with overnight sessions, one of which spans the change.
+const testCalendar = `{
+  "default": "NYSE",
+  "tickers": {"ES": "CME"},
+  "exchanges": {
+    "NYSE": {
+      "timezone": "America/New_York", "open": "09:30", "close": "16:00",
+      "weekends": ["Saturday", "Sunday"],
+      "holidays": ["2019-07-04"],
+      "half_days": [{"date": "2019-07-03", "close": "13:00"}]
+    },
+    "CME": {
+      "timezone": "America/New_York", "open": "18:00", "close": "17:00",
+      "weekends": ["Friday"]
+    }
+  }
+}`
+
+func loadTestCalendar(t *testing.T, data string) (*Calendar, error) {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "calendar.json")
+	if err := ioutil.WriteFile(filename, []byte(data), 0o644); err != nil { //nolint
+		t.Fatal(err)
+	}
+
+	return Load(filename)
+}
+
+func utc(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func TestSession(t *testing.T) {
+	c, err := loadTestCalendar(t, testCalendar)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		ticker string
+		at     string
+		open   string
+		close  string
+	}{
+		"standard time":              {at: "2019-03-08T14:30:00Z", open: "2019-03-08T14:30:00Z", close: "2019-03-08T21:00:00Z"},
+		"before the open":            {at: "2019-03-08T14:29:59Z"},
+		"at the close":               {at: "2019-03-08T21:00:00Z"},
+		"weekend":                    {at: "2019-03-09T15:00:00Z"},
+		"daylight saving time":       {at: "2019-03-11T13:30:00Z", open: "2019-03-11T13:30:00Z", close: "2019-03-11T20:00:00Z"},
+		"standard time open in DST":  {at: "2019-03-11T13:29:59Z"},
+		"daylight saving time close": {at: "2019-03-11T20:30:00Z"},
+		"back to standard time":      {at: "2019-11-04T20:30:00Z", open: "2019-11-04T14:30:00Z", close: "2019-11-04T21:00:00Z"},
+		"half-day":                   {at: "2019-07-03T16:59:59Z", open: "2019-07-03T13:30:00Z", close: "2019-07-03T17:00:00Z"},
+		"after the half-day close":   {at: "2019-07-03T17:00:00Z"},
+		"holiday":                    {at: "2019-07-04T15:00:00Z"},
+		"after the holiday":          {at: "2019-07-05T15:00:00Z", open: "2019-07-05T13:30:00Z", close: "2019-07-05T20:00:00Z"},
+		// The session opens at 18:00 EST and closes at 17:00 EDT, 22 hours later.
+		"overnight across the change": {ticker: "ES", at: "2019-03-10T12:00:00Z", open: "2019-03-09T23:00:00Z", close: "2019-03-10T21:00:00Z"},
+		"overnight next day":          {ticker: "ES", at: "2019-03-10T22:00:00Z", open: "2019-03-10T22:00:00Z", close: "2019-03-11T21:00:00Z"},
+		"overnight break":             {ticker: "ES", at: "2019-03-10T21:30:00Z"},
+		"overnight weekend":           {ticker: "ES", at: "2019-03-09T12:00:00Z"},
+		"overnight from a weekday":    {ticker: "ES", at: "2019-03-08T12:00:00Z", open: "2019-03-07T23:00:00Z", close: "2019-03-08T22:00:00Z"},
+	}
+
+	for name, tt := range tests {
+		ticker := tt.ticker
+		if ticker == "" {
+			ticker = "AAPL"
+		}
+
+		session, ok := c.Session(ticker, utc(tt.at))
+		if ok != (tt.open != "") {
+			t.Errorf("%s: got session %t, want %t", name, ok, !ok)
+			continue
+		}
+
+		if ok && (!session.Open.Equal(utc(tt.open)) || !session.Close.Equal(utc(tt.close))) {
+			t.Errorf("%s: got %s - %s, want %s - %s", name, session.Open, session.Close, tt.open, tt.close)
+		}
+	}
+}
+
+func TestDefault(t *testing.T) {
+	c := Default()
+
+	tests := map[string]struct {
+		at   string
+		open string
+	}{
+		"open":      {at: "2019-01-30T07:00:00Z", open: "2019-01-30T07:00:00Z"},
+		"overnight": {at: "2019-01-31T02:59:59Z", open: "2019-01-30T07:00:00Z"},
+		"closed":    {at: "2019-01-31T03:00:00Z"},
+		"saturday":  {at: "2019-02-02T12:00:00Z", open: "2019-02-02T07:00:00Z"},
+	}
+
+	for name, tt := range tests {
+		session, ok := c.Session("AAPL", utc(tt.at))
+		if ok != (tt.open != "") || ok && !session.Open.Equal(utc(tt.open)) {
+			t.Errorf("%s: got %s %t, want %s", name, session.Open, ok, tt.open)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := map[string]struct {
+		data string
+		err  string
+	}{
+		"bad json": {data: `{`, err: "can't parse"},
+		"no default": {
+			data: `{"default": "X", "exchanges": {"Y": {"open": "10:00", "close": "18:00"}}}`,
+			err:  `default exchange "X" is not defined`,
+		},
+		"undefined exchange": {
+			data: `{"default": "Y", "tickers": {"SBER": "X"}, "exchanges": {"Y": {"open": "10:00", "close": "18:00"}}}`,
+			err:  `ticker SBER trades on undefined exchange "X"`,
+		},
+		"bad timezone": {
+			data: `{"default": "Y", "exchanges": {"Y": {"timezone": "Mars/Olympus", "open": "10:00", "close": "18:00"}}}`,
+			err:  "Mars/Olympus",
+		},
+		"bad open": {
+			data: `{"default": "Y", "exchanges": {"Y": {"open": "25:00", "close": "18:00"}}}`,
+			err:  "open: bad time of day",
+		},
+		"bad weekday": {
+			data: `{"default": "Y", "exchanges": {"Y": {"open": "10:00", "close": "18:00", "weekends": ["Caturday"]}}}`,
+			err:  `unknown weekday "Caturday"`,
+		},
+		"bad holiday": {
+			data: `{"default": "Y", "exchanges": {"Y": {"open": "10:00", "close": "18:00", "holidays": ["2019-02-30"]}}}`,
+			err:  `bad holiday "2019-02-30"`,
+		},
+		"bad half-day": {
+			data: `{"default": "Y", "exchanges": {"Y": {"open": "10:00", "close": "18:00",` +
+				` "half_days": [{"date": "2019-12-31", "close": "2pm"}]}}}`,
+			err: "half-day 2019-12-31 close",
+		},
+	}
+
+	for name, tt := range tests {
+		_, err := loadTestCalendar(t, tt.data)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: got %v, want %q", name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Package candle reads and writes OHLC candles and the trades they are built from as CSV.
+//
+// A candle file has one candle per line:
+//
+//	ticker,timestamp,open,high,low,close,volume,turnover,trades,vwap
+//
+// with an RFC 3339 timestamp. The last four columns are optional, files written before
+// they were added have six. The first line may be a header with these column names,
+// in which case the columns are matched by name and may come in any order.
+//
+// A trade file has no header and one trade per line:
+//
+//	ticker,price,amount,2019-01-30 07:00:00.140891
+//
+// with the timestamp in UTC.
+package candle
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+type Candle struct {
+	Ticker       string
+	Timestamp    time.Time
+	OpeningPrice decimal.Decimal
+	MaxPrice     decimal.Decimal
+	MinPrice     decimal.Decimal
+	ClosingPrice decimal.Decimal
+	// Volume is the traded amount.
+	Volume int64
+	// Turnover is the sum of price × amount of the trades.
+	Turnover decimal.Decimal
+	// Trades is the number of trades.
+	Trades int64
+	// VWAP is the volume weighted average price, zero when Volume is.
+	VWAP decimal.Decimal
+}
+
+// Columns are the header names, in the order the Writer writes them. The columns after
+// close are optional.
+var Columns = []string{
+	"ticker", "timestamp", "open", "high", "low", "close", "volume", "turnover", "trades", "vwap",
+}
+
+// requiredColumns is the number of leading Columns every candle file has.
+const requiredColumns = 6
+
+// Stats fills Volume, Turnover, Trades and VWAP from the trades of the candle. It returns
+// decimal.ErrRange when the volume or the turnover of the trades overflows.
+func (c *Candle) Stats(trades []Trade) error {
+	c.Volume, c.Turnover, c.Trades, c.VWAP = 0, decimal.Zero, 0, decimal.Zero
+
+	for _, trade := range trades {
+		if err := c.AddTrade(trade); err != nil {
+			return err
+		}
+	}
+
+	if c.Volume == 0 {
+		return nil
+	}
+
+	var err error
+	c.VWAP, err = c.Turnover.Div(decimal.FromInt(c.Volume))
+
+	return err
+}
+
+// AddTrade adds the trade to Volume, Turnover and Trades, but leaves VWAP to Stats. On
+// overflow it returns decimal.ErrRange and leaves the candle unchanged.
+func (c *Candle) AddTrade(trade Trade) error {
+	turnover, err := trade.Price.CheckedMulInt(int64(trade.Amount))
+	if err != nil {
+		return err
+	}
+
+	if turnover, err = c.Turnover.CheckedAdd(turnover); err != nil {
+		return err
+	}
+
+	volume := c.Volume + int64(trade.Amount)
+	if (trade.Amount > 0) != (volume > c.Volume) {
+		return decimal.ErrRange
+	}
+
+	c.Volume, c.Turnover = volume, turnover
+	c.Trades++
+
+	return nil
+}
+
+var (
+	ErrFieldCount   = errors.New("wrong number of fields")
+	ErrMissingField = errors.New("missing field")
+	ErrPriceRange   = errors.New("open and close must be within low and high")
+)
+
+// ParseError reports a malformed record. Line and Column are 1-based, Column counts
+// characters from the start of the line.
+type ParseError struct {
+	Line   int
+	Column int
+	Field  string
+	Err    error
+	// Record holds the fields of the record, it is nil when the line is not valid CSV.
+	Record []string
+}
+
+func (e *ParseError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Err)
+	}
+
+	return fmt.Sprintf("line %d, column %d, field %s: %s", e.Line, e.Column, e.Field, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,374 @@
+package candle
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+func testCandles() []Candle {
+	at := time.Date(2019, 1, 30, 7, 0, 0, 0, time.UTC)
+
+	candles := []Candle{
+		{Ticker: "AAPL", Timestamp: at, OpeningPrice: decimal.MustParse("161.22"),
+			MaxPrice: decimal.MustParse("162.88"), MinPrice: decimal.MustParse("156.25"),
+			ClosingPrice: decimal.MustParse("161.08")},
+		{Ticker: "SBER", Timestamp: at.Add(5 * time.Minute), OpeningPrice: decimal.MustParse("213.8"),
+			MaxPrice: decimal.MustParse("214.14"), MinPrice: decimal.MustParse("213.1"),
+			ClosingPrice: decimal.MustParse("213.17")},
+	}
+
+	candles[0].Stats([]Trade{
+		{Ticker: "AAPL", Price: decimal.MustParse("161.22"), Amount: 10},
+		{Ticker: "AAPL", Price: decimal.MustParse("161.08"), Amount: 5},
+	}) //nolint
+
+	return candles
+}
+
+func readAll(t *testing.T, r *Reader) []Candle {
+	t.Helper()
+
+	var candles []Candle
+
+	for {
+		c, err := r.Read()
+		if err == io.EOF {
+			return candles
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		candles = append(candles, c)
+	}
+}
+
+func equalCandles(t *testing.T, got, want []Candle) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("candle %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	price := decimal.MustParse("9000000")
+
+	tests := map[string]struct {
+		trades []Trade
+		want   Candle
+		err    error
+	}{
+		"no trades": {},
+		"vwap": {
+			trades: []Trade{{Price: decimal.MustParse("10"), Amount: 1}, {Price: decimal.MustParse("20"), Amount: 3}},
+			want:   Candle{Volume: 4, Turnover: decimal.MustParse("70"), Trades: 2, VWAP: decimal.MustParse("17.5")},
+		},
+		"turnover overflow": {
+			trades: []Trade{{Price: price, Amount: 1000000}, {Price: price, Amount: 1000000}},
+			err:    decimal.ErrRange,
+		},
+		"single trade overflow": {
+			trades: []Trade{{Price: price, Amount: 2000000}},
+			err:    decimal.ErrRange,
+		},
+		"volume overflow": {
+			trades: []Trade{{Amount: math.MaxInt64}, {Amount: 1}},
+			err:    decimal.ErrRange,
+		},
+	}
+
+	for name, tt := range tests {
+		var c Candle
+
+		err := c.Stats(tt.trades)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v, want %v", name, err, tt.err)
+			continue
+		}
+
+		if tt.err == nil && c != tt.want {
+			t.Errorf("%s: got %+v, want %+v", name, c, tt.want)
+		}
+	}
+}
+
+// AddTrade leaves the candle unchanged when the trade overflows it.
+func TestAddTradeOverflow(t *testing.T) {
+	c := Candle{Volume: 1, Turnover: decimal.FromUnits(math.MaxInt64), Trades: 1}
+	want := c
+
+	if err := c.AddTrade(Trade{Price: decimal.MustParse("0.000001"), Amount: 1}); !errors.Is(err, decimal.ErrRange) {
+		t.Fatalf("got error %v, want %v", err, decimal.ErrRange)
+	}
+
+	if c != want {
+		t.Fatalf("got %+v, want %+v", c, want)
+	}
+}
+
+// TestRoundTrip reads what the Writer writes, as hw1 reads the candles of hw3.
+func TestRoundTrip(t *testing.T) {
+	want := testCandles()
+
+	for _, header := range []bool{false, true} {
+		for _, mode := range []Mode{Strict, Lenient} {
+			var buf bytes.Buffer
+
+			w := NewWriter(&buf)
+			w.Header = header
+
+			for _, c := range want {
+				if err := w.Write(c); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			r := NewReader(&buf)
+			r.Mode = mode
+
+			equalCandles(t, readAll(t, r), want)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	want := testCandles()[1:]
+	want[0].Volume = 7
+
+	for name, input := range map[string]string{
+		"no header":      "SBER,2019-01-30T07:05:00Z,213.8,214.14,213.1,213.17,7,0,0,0\n",
+		"header":         "ticker,timestamp,open,high,low,close,volume\nSBER,2019-01-30T07:05:00Z,213.8,214.14,213.1,213.17,7\n",
+		"reordered":      "Close,Low,High,Open,Time,Ticker,Volume\n213.17,213.1,214.14,213.8,2019-01-30T07:05:00Z,SBER,7\n",
+		"unknown column": "ticker,note,timestamp,open,high,low,close,volume\nSBER,x,2019-01-30T07:05:00Z,213.8,214.14,213.1,213.17,7\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			equalCandles(t, readAll(t, NewReader(strings.NewReader(input))), want)
+		})
+	}
+
+	// Without a header six fields are the prices only.
+	r := NewReader(strings.NewReader("SBER,2019-01-30T07:05:00Z,213.8,214.14,213.1,213.17\n"))
+	want[0].Volume = 0
+	equalCandles(t, readAll(t, r), want)
+}
+
+func TestHeaderMissingColumn(t *testing.T) {
+	r := NewReader(strings.NewReader("ticker,timestamp,open,high,close\n"))
+
+	_, err := r.Read()
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Field != "low" || !errors.Is(err, ErrMissingField) {
+		t.Fatalf("got %v, want a missing low field", err)
+	}
+}
+
+const malformed = `AAPL,2019-01-30T07:00:00Z,161.22,162.88,156.25,161.08
+AAPL,2019-01-30T07:05:00Z,162.41,162.44,161.06
+AAPL,2019-01-30T07:10:00Z,161.36,161.5,161.2,161.4,extra
+AAPL,2019-01-30T07:15:00Z,170,161.5,161.2,161.4
+AAPL,2019-01-30T07:20:00Z, 161.3 ,161.5,161.2,161.4
+AAPL,2019-01-30T07:25:00Z,161.3,161.5,161.2,161.4
+`
+
+func TestStrict(t *testing.T) {
+	r := NewReader(strings.NewReader(malformed))
+
+	if _, err := r.Read(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := r.Read()
+	if !errors.Is(err, ErrFieldCount) {
+		t.Fatalf("got %v, want %v", err, ErrFieldCount)
+	}
+}
+
+func TestLenient(t *testing.T) {
+	r := NewReader(strings.NewReader(malformed))
+	r.Mode = Lenient
+
+	var skipped []int
+	r.OnSkip = func(err *ParseError) {
+		skipped = append(skipped, err.Line)
+	}
+
+	// The extra field is ignored, the out of range open and the spaces are fine, only
+	// the record with a missing field is skipped.
+	candles := readAll(t, r)
+	if len(candles) != 5 {
+		t.Fatalf("read %d candles, want 5", len(candles))
+	}
+
+	if !candles[3].OpeningPrice.Equal(decimal.MustParse("161.3")) {
+		t.Errorf("open %s, want 161.3", candles[3].OpeningPrice)
+	}
+
+	if r.Skipped() != 1 || len(skipped) != 1 || skipped[0] != 2 {
+		t.Errorf("skipped %d records on lines %v, want line 2", r.Skipped(), skipped)
+	}
+}
+
+func TestStrictChecks(t *testing.T) {
+	for name, tc := range map[string]struct {
+		line string
+		err  error
+	}{
+		"extra field": {line: "AAPL,2019-01-30T07:10:00Z,161.36,161.5,161.2,161.4,extra", err: ErrFieldCount},
+		"price range": {line: "AAPL,2019-01-30T07:15:00Z,170,161.5,161.2,161.4", err: ErrPriceRange},
+		"spaces":      {line: "AAPL,2019-01-30T07:20:00Z, 161.3 ,161.5,161.2,161.4", err: decimal.ErrSyntax},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(tc.line + "\n")).Read()
+			if !errors.Is(err, tc.err) {
+				t.Errorf("got %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	for name, tc := range map[string]struct {
+		input        string
+		line, column int
+		field        string
+	}{
+		"bad price": {
+			input: "AAPL,2019-01-30T07:00:00Z,161.22,162.88,156.25,161.08\nAAPL,2019-01-30T07:05:00Z,162.41,x,161.06,161.36\n",
+			line:  2, column: 34, field: "high",
+		},
+		"bad time after header": {
+			input: "ticker,timestamp,open,high,low,close\nAAPL,30.01.2019,1,1,1,1\n",
+			line:  2, column: 6, field: "timestamp",
+		},
+		"field count": {
+			input: "\n\nAAPL,2019-01-30T07:00:00Z,1,1,1\n",
+			line:  3, column: 1,
+		},
+		"bad quote": {
+			input: "AAPL,2019-01-30T07:00:00Z,1,1,1,1\nAAPL,\"2019\"x,1,1,1,1\n",
+			line:  2, column: 11,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(tc.input))
+
+			var err error
+			for err == nil {
+				_, err = r.Read()
+			}
+
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("got %v, want a *ParseError", err)
+			}
+
+			if parseErr.Line != tc.line || parseErr.Column != tc.column || parseErr.Field != tc.field {
+				t.Errorf("got line %d, column %d, field %q, want line %d, column %d, field %q",
+					parseErr.Line, parseErr.Column, parseErr.Field, tc.line, tc.column, tc.field)
+			}
+		})
+	}
+}
+
+func TestTradeReader(t *testing.T) {
+	input := `AAPL,161.22,10,2019-01-30 07:00:00.140891
+AAPL,x,10,2019-01-30 07:00:01
+AAPL, 161.3 ,5,2019-01-30 07:00:02
+`
+	want := Trade{
+		Ticker:    "AAPL",
+		Price:     decimal.MustParse("161.22"),
+		Amount:    10,
+		Timestamp: time.Date(2019, 1, 30, 7, 0, 0, 140891000, time.UTC),
+	}
+
+	r := NewTradeReader(strings.NewReader(input))
+
+	if trade, err := r.Read(); err != nil || trade != want {
+		t.Fatalf("got %+v, %v, want %+v", trade, err, want)
+	}
+
+	_, err := r.Read()
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 2 || parseErr.Column != 6 || parseErr.Field != "price" {
+		t.Fatalf("got %v, want line 2, column 6, field price", err)
+	}
+
+	lenient := NewTradeReader(strings.NewReader(input))
+	lenient.Mode = Lenient
+
+	count := 0
+
+	for {
+		_, err := lenient.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		count++
+	}
+
+	if count != 2 || lenient.Skipped() != 1 {
+		t.Errorf("read %d trades and skipped %d, want 2 and 1", count, lenient.Skipped())
+	}
+}
+
+// TestParseTradeTime checks parseTradeTime against time.Parse.
+func TestParseTradeTime(t *testing.T) {
+	for _, value := range []string{
+		"2019-01-30 07:00:00",
+		"2019-01-30 07:00:00.140891",
+		"2019-01-30 07:00:00.1",
+		"2019-01-30 07:00:00.123456789",
+		"2019-01-30 07:00:00.1234567891",
+		"2019-01-30 07:00:00.",
+		"2019-01-30 07:00:00,1",
+		"2019-01-30 07:00:00.1x",
+		"2020-02-29 23:59:59",
+		"2019-02-29 00:00:00",
+		"2019-04-31 00:00:00",
+		"2019-13-01 00:00:00",
+		"2019-00-01 00:00:00",
+		"2019-01-00 00:00:00",
+		"2019-01-30 24:00:00",
+		"2019-01-30 07:60:00",
+		"2019-01-30 07:00:60",
+		"2019-01-30T07:00:00",
+		"2019-1-30 07:00:00",
+		"+019-01-30 07:00:00",
+		"2019-01-30 07:00",
+		"",
+	} {
+		want, wantErr := time.Parse(TradeTimeLayout, value)
+		got, err := parseTradeTime(value)
+
+		if !got.Equal(want) || got.Location() != want.Location() || (err == nil) != (wantErr == nil) {
+			t.Errorf("%q: got %s, %v, want %s, %v", value, got, err, want, wantErr)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package candle
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+// Mode tells the Reader what to do with malformed records.
+type Mode int
+
+const (
+	// Strict fails on the first malformed record. Every record must have as many fields
+	// as the header and its open and close prices must be within its low and high.
+	Strict Mode = iota
+	// Lenient skips malformed records, ignores extra fields and trims spaces around values.
+	Lenient
+)
+
+const (
+	tickerColumn = iota
+	timestampColumn
+	openColumn
+	highColumn
+	lowColumn
+	closeColumn
+	volumeColumn
+	turnoverColumn
+	tradesColumn
+	vwapColumn
+)
+
+// Reader streams candles from a CSV file.
+type Reader struct {
+	Mode Mode
+	// OnSkip, when set, is called with every record the Lenient mode skips.
+	OnSkip func(err *ParseError)
+
+	csv     *csv.Reader
+	started bool
+	columns []int
+	fields  int
+	skipped int
+}
+
+func NewReader(r io.Reader) *Reader {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+
+	return &Reader{csv: reader, columns: positions(requiredColumns), fields: requiredColumns}
+}
+
+// positions maps the first n Columns to the fields in the same place, the others to -1.
+func positions(n int) []int {
+	columns := make([]int, len(Columns))
+	for i := range columns {
+		columns[i] = -1
+		if i < n {
+			columns[i] = i
+		}
+	}
+
+	return columns
+}
+
+// Skipped returns the number of records the Lenient mode has skipped so far.
+func (r *Reader) Skipped() int {
+	return r.skipped
+}
+
+// Read returns the next candle or io.EOF at the end of the input. Malformed records
+// are reported as *ParseError.
+func (r *Reader) Read() (Candle, error) {
+	for {
+		candle, err := r.read()
+
+		var parseErr *ParseError
+		if r.Mode != Lenient || !errors.As(err, &parseErr) {
+			return candle, err
+		}
+
+		r.skipped++
+		if r.OnSkip != nil {
+			r.OnSkip(parseErr)
+		}
+	}
+}
+
+func (r *Reader) read() (Candle, error) {
+	record, err := r.csv.Read()
+	if err != nil {
+		var csvErr *csv.ParseError
+		if errors.As(err, &csvErr) {
+			return Candle{}, &ParseError{Line: csvErr.Line, Column: csvErr.Column, Err: csvErr.Err}
+		}
+
+		return Candle{}, err
+	}
+
+	if !r.started {
+		r.started = true
+
+		if isHeader(record) {
+			if err := r.readHeader(record); err != nil {
+				return Candle{}, err
+			}
+
+			return r.read()
+		}
+
+		// Without a header the optional columns are there when all columns are.
+		if len(record) == len(Columns) {
+			r.columns = positions(len(Columns))
+			r.fields = len(Columns)
+		}
+	}
+
+	return r.parse(record)
+}
+
+// isHeader tells a header from a candle by the ticker column name.
+func isHeader(record []string) bool {
+	for _, name := range record {
+		if strings.EqualFold(strings.TrimSpace(name), Columns[tickerColumn]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readHeader maps the columns by name. Unknown columns are ignored.
+func (r *Reader) readHeader(record []string) error {
+	columns := positions(0)
+
+	for i, name := range record {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "time" {
+			name = Columns[timestampColumn]
+		}
+
+		for column, known := range Columns {
+			if name == known {
+				columns[column] = i
+			}
+		}
+	}
+
+	for column, i := range columns[:requiredColumns] {
+		if i < 0 {
+			line, col := r.csv.FieldPos(0)
+			return &ParseError{Line: line, Column: col, Field: Columns[column], Err: ErrMissingField}
+		}
+	}
+
+	r.columns = columns
+	r.fields = len(record)
+
+	return nil
+}
+
+func (r *Reader) parse(record []string) (Candle, error) {
+	fail := func(column int, err error) (Candle, error) {
+		field := 0
+		if column >= 0 && r.columns[column] >= 0 && r.columns[column] < len(record) {
+			field = r.columns[column]
+		}
+
+		line, col := r.csv.FieldPos(field)
+		parseErr := &ParseError{Line: line, Column: col, Err: err, Record: append([]string(nil), record...)}
+		if column >= 0 {
+			parseErr.Field = Columns[column]
+		}
+
+		return Candle{}, parseErr
+	}
+
+	if r.Mode == Strict && len(record) != r.fields {
+		return fail(-1, ErrFieldCount)
+	}
+
+	value := func(column int) (string, bool) {
+		i := r.columns[column]
+		if i < 0 || i >= len(record) {
+			return "", false
+		}
+
+		if r.Mode == Lenient {
+			return strings.TrimSpace(record[i]), true
+		}
+
+		return record[i], true
+	}
+
+	var candle Candle
+
+	ticker, ok := value(tickerColumn)
+	if !ok || ticker == "" {
+		return fail(tickerColumn, ErrMissingField)
+	}
+
+	candle.Ticker = ticker
+
+	timestamp, ok := value(timestampColumn)
+	if !ok {
+		return fail(timestampColumn, ErrMissingField)
+	}
+
+	var err error
+	if candle.Timestamp, err = time.Parse(time.RFC3339, timestamp); err != nil {
+		return fail(timestampColumn, err)
+	}
+
+	prices := []*decimal.Decimal{&candle.OpeningPrice, &candle.MaxPrice, &candle.MinPrice, &candle.ClosingPrice}
+	for i, price := range prices {
+		column := openColumn + i
+
+		text, ok := value(column)
+		if !ok {
+			return fail(column, ErrMissingField)
+		}
+
+		if *price, err = decimal.Parse(text); err != nil {
+			return fail(column, err)
+		}
+	}
+
+	// The optional columns are read when the file has them.
+	if text, ok := value(volumeColumn); ok {
+		if candle.Volume, err = strconv.ParseInt(text, 10, 64); err != nil {
+			return fail(volumeColumn, err)
+		}
+	}
+
+	if text, ok := value(turnoverColumn); ok {
+		if candle.Turnover, err = decimal.Parse(text); err != nil {
+			return fail(turnoverColumn, err)
+		}
+	}
+
+	if text, ok := value(tradesColumn); ok {
+		if candle.Trades, err = strconv.ParseInt(text, 10, 64); err != nil {
+			return fail(tradesColumn, err)
+		}
+	}
+
+	if text, ok := value(vwapColumn); ok {
+		if candle.VWAP, err = decimal.Parse(text); err != nil {
+			return fail(vwapColumn, err)
+		}
+	}
+
+	if r.Mode == Strict && !inRange(candle) {
+		return fail(-1, ErrPriceRange)
+	}
+
+	return candle, nil
+}
+
+func inRange(candle Candle) bool {
+	for _, price := range []decimal.Decimal{candle.OpeningPrice, candle.ClosingPrice} {
+		if price.LessThan(candle.MinPrice) || price.GreaterThan(candle.MaxPrice) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,191 @@
+package candle
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+// Trade is a single deal the candles are built from.
+type Trade struct {
+	Ticker    string
+	Price     decimal.Decimal
+	Amount    int
+	Timestamp time.Time
+}
+
+// TradeTimeLayout is the timestamp format of trade files, always in UTC.
+const TradeTimeLayout = "2006-01-02 15:04:05.999999999"
+
+// TradeColumns are the columns of a trade file, which has no header.
+var TradeColumns = []string{"ticker", "price", "amount", "timestamp"}
+
+// TradeReader streams trades from a CSV file with ticker,price,amount,timestamp
+// records.
+type TradeReader struct {
+	Mode Mode
+	// OnSkip, when set, is called with every record the Lenient mode skips.
+	OnSkip func(err *ParseError)
+
+	csv     *csv.Reader
+	skipped int
+}
+
+func NewTradeReader(r io.Reader) *TradeReader {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+
+	return &TradeReader{csv: reader}
+}
+
+// Skipped returns the number of records the Lenient mode has skipped so far.
+func (r *TradeReader) Skipped() int {
+	return r.skipped
+}
+
+// Read returns the next trade or io.EOF at the end of the input. Malformed records
+// are reported as *ParseError.
+func (r *TradeReader) Read() (Trade, error) {
+	for {
+		trade, err := r.read()
+		if err == nil || r.Mode != Lenient {
+			return trade, err
+		}
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			return trade, err
+		}
+
+		r.skipped++
+		if r.OnSkip != nil {
+			r.OnSkip(parseErr)
+		}
+	}
+}
+
+func (r *TradeReader) read() (Trade, error) {
+	record, err := r.csv.Read()
+	if err != nil {
+		var csvErr *csv.ParseError
+		if errors.As(err, &csvErr) {
+			return Trade{}, &ParseError{Line: csvErr.Line, Column: csvErr.Column, Err: csvErr.Err}
+		}
+
+		return Trade{}, err
+	}
+
+	fail := func(field int, err error) (Trade, error) {
+		position := field
+		if position < 0 {
+			position = 0
+		}
+
+		line, col := r.csv.FieldPos(position)
+		parseErr := &ParseError{Line: line, Column: col, Err: err, Record: append([]string(nil), record...)}
+		if field >= 0 {
+			parseErr.Field = TradeColumns[field]
+		}
+
+		return Trade{}, parseErr
+	}
+
+	if len(record) < len(TradeColumns) || r.Mode == Strict && len(record) != len(TradeColumns) {
+		return fail(-1, ErrFieldCount)
+	}
+
+	value := func(field int) string {
+		if r.Mode == Lenient {
+			return strings.TrimSpace(record[field])
+		}
+
+		return record[field]
+	}
+
+	trade := Trade{Ticker: value(0)}
+	if trade.Ticker == "" {
+		return fail(0, ErrMissingField)
+	}
+
+	if trade.Price, err = decimal.Parse(value(1)); err != nil {
+		return fail(1, err)
+	}
+
+	if trade.Amount, err = strconv.Atoi(value(2)); err != nil {
+		return fail(2, err)
+	}
+
+	// Keeps the turnover of a candle from overflowing on a single trade.
+	if _, err = trade.Price.CheckedMulInt(int64(trade.Amount)); err != nil {
+		return fail(2, err)
+	}
+
+	if trade.Timestamp, err = parseTradeTime(value(3)); err != nil {
+		return fail(3, err)
+	}
+
+	return trade, nil
+}
+
+// parseTradeTime parses a TradeTimeLayout timestamp like time.Parse, which is the most of
+// the time spent reading a trade. Values it doesn't handle go to time.Parse, so does
+// the error reporting.
+func parseTradeTime(value string) (time.Time, error) {
+	const (
+		dateTime = len("2006-01-02 15:04:05")
+		maxFrac  = len(".999999999")
+	)
+
+	number := func(from, to int) int {
+		n := 0
+
+		for i := from; i < to; i++ {
+			if value[i] < '0' || value[i] > '9' {
+				return -1
+			}
+
+			n = n*10 + int(value[i]-'0')
+		}
+
+		return n
+	}
+
+	if len(value) < dateTime || len(value) > dateTime+maxFrac || len(value) == dateTime+1 ||
+		value[4] != '-' || value[7] != '-' || value[10] != ' ' || value[13] != ':' || value[16] != ':' {
+		return time.Parse(TradeTimeLayout, value)
+	}
+
+	year, month, day := number(0, 4), number(5, 7), number(8, 10)
+	hour, minute, second := number(11, 13), number(14, 16), number(17, 19)
+
+	nanosecond := 0
+	if len(value) > dateTime {
+		if value[dateTime] != '.' {
+			return time.Parse(TradeTimeLayout, value)
+		}
+
+		nanosecond = number(dateTime+1, len(value))
+		for i := len(value); i < dateTime+maxFrac; i++ {
+			nanosecond *= 10
+		}
+	}
+
+	if year < 0 || month < 1 || month > 12 || day < 1 || hour < 0 || hour > 23 ||
+		minute < 0 || minute > 59 || second < 0 || second > 59 || nanosecond < 0 {
+		return time.Parse(TradeTimeLayout, value)
+	}
+
+	t := time.Date(year, time.Month(month), day, hour, minute, second, nanosecond, time.UTC)
+	if t.Day() != day {
+		// Past the end of the month.
+		return time.Parse(TradeTimeLayout, value)
+	}
+
+	return t, nil
+}
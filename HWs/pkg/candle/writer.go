@@ -0,0 +1,53 @@
+package candle
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Writer writes candles as CSV. Writes are buffered, call Flush when done.
+type Writer struct {
+	// Header writes the column names before the first candle.
+	Header bool
+
+	csv     *csv.Writer
+	started bool
+	record  []string
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{csv: csv.NewWriter(w), record: make([]string, len(Columns))}
+}
+
+func (w *Writer) Write(candle Candle) error {
+	if !w.started {
+		w.started = true
+
+		if w.Header {
+			if err := w.csv.Write(Columns); err != nil {
+				return err
+			}
+		}
+	}
+
+	w.record[tickerColumn] = candle.Ticker
+	w.record[timestampColumn] = candle.Timestamp.Format(time.RFC3339)
+	w.record[openColumn] = candle.OpeningPrice.String()
+	w.record[highColumn] = candle.MaxPrice.String()
+	w.record[lowColumn] = candle.MinPrice.String()
+	w.record[closeColumn] = candle.ClosingPrice.String()
+	w.record[volumeColumn] = strconv.FormatInt(candle.Volume, 10)
+	w.record[turnoverColumn] = candle.Turnover.String()
+	w.record[tradesColumn] = strconv.FormatInt(candle.Trades, 10)
+	w.record[vwapColumn] = candle.VWAP.String()
+
+	return w.csv.Write(w.record)
+}
+
+// Flush writes any buffered candles and returns the first write error, if any.
+func (w *Writer) Flush() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
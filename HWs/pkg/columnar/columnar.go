@@ -0,0 +1,256 @@
+// Package columnar stores candles, trades and user trades, see package usertrade, in a
+// compact binary, column-oriented file.
+//
+// A file is a header, a sequence of blocks and an index of the blocks:
+//
+//	header:  "TCOL" | version byte | kind byte | value column count uvarint
+//	block:   tickers | user IDs | timestamps | value columns
+//	index:   block count uvarint | per block offset, size, rows uvarint, min and max time varint
+//	trailer: index offset uint64 little endian | "TCOL"
+//
+// A block holds up to BlockRows rows column by column. The tickers are a dictionary
+// followed by a dictionary index per row, and so are the user IDs, which only user
+// trade files have. Timestamps, as Unix nanoseconds, and every value column are zigzag
+// varint deltas from the previous row. Prices are stored as decimal units, see
+// decimal.Decimal.Units.
+//
+// Candle files have the open, high, low, close, volume, turnover, trades and VWAP value
+// columns, trade files the price and amount, user trade files the buy price, sell price
+// and lots.
+//
+// Readers use the min and max timestamps of the index to skip whole blocks outside
+// the requested time range.
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	magic   = "TCOL"
+	version = 1
+
+	candleKind    byte = 1
+	tradeKind     byte = 2
+	userTradeKind byte = 3
+
+	trailerSize = 12 // index offset and magic
+
+	// candleColumns are open, high, low, close, volume, turnover, trades and VWAP,
+	// tradeColumns price and amount, userTradeColumns buy price, sell price and lots.
+	candleColumns    = 8
+	tradeColumns     = 2
+	userTradeColumns = 3
+)
+
+// BlockRows is the number of rows in a block, the unit of a seek.
+const BlockRows = 4096
+
+var (
+	ErrFormat  = errors.New("not a columnar file")
+	ErrKind    = errors.New("columnar file holds another kind of records")
+	ErrCorrupt = errors.New("corrupt columnar file")
+)
+
+// IsColumnar tells whether the input starts like a columnar file.
+func IsColumnar(in io.ReaderAt) bool {
+	head := make([]byte, len(magic))
+	if _, err := in.ReadAt(head, 0); err != nil {
+		return false
+	}
+
+	return string(head) == magic
+}
+
+type blockInfo struct {
+	offset  int64
+	size    int64
+	rows    int
+	minTime int64
+	maxTime int64
+}
+
+// block is a batch of rows kept column by column. Only blocks of user trades have users.
+type block struct {
+	tickers  []string
+	users    []string
+	hasUsers bool
+	times    []int64
+	values   [][]int64
+}
+
+func newBlock(kind byte, columns int) *block {
+	return &block{values: make([][]int64, columns), hasUsers: kind == userTradeKind}
+}
+
+func (b *block) len() int {
+	return len(b.times)
+}
+
+func (b *block) reset() {
+	b.tickers = b.tickers[:0]
+	b.users = b.users[:0]
+	b.times = b.times[:0]
+
+	for i := range b.values {
+		b.values[i] = b.values[i][:0]
+	}
+}
+
+func (b *block) timeRange() (min, max int64) {
+	min, max = b.times[0], b.times[0]
+	for _, t := range b.times[1:] {
+		if t < min {
+			min = t
+		}
+
+		if t > max {
+			max = t
+		}
+	}
+
+	return min, max
+}
+
+func (b *block) encode(out *bytes.Buffer) {
+	var scratch [binary.MaxVarintLen64]byte
+
+	putUvarint := func(value uint64) {
+		out.Write(scratch[:binary.PutUvarint(scratch[:], value)])
+	}
+
+	putDeltas := func(column []int64) {
+		previous := int64(0)
+		for _, value := range column {
+			out.Write(scratch[:binary.PutVarint(scratch[:], value-previous)])
+			previous = value
+		}
+	}
+
+	putStrings := func(column []string) {
+		dictionary := make(map[string]uint64)
+		indexes := make([]uint64, len(column))
+
+		var names []string
+
+		for i, value := range column {
+			index, ok := dictionary[value]
+			if !ok {
+				index = uint64(len(names))
+				dictionary[value] = index
+				names = append(names, value)
+			}
+
+			indexes[i] = index
+		}
+
+		putUvarint(uint64(len(names)))
+
+		for _, name := range names {
+			putUvarint(uint64(len(name)))
+			out.WriteString(name)
+		}
+
+		for _, index := range indexes {
+			putUvarint(index)
+		}
+	}
+
+	putStrings(b.tickers)
+
+	if b.hasUsers {
+		putStrings(b.users)
+	}
+
+	putDeltas(b.times)
+
+	for _, column := range b.values {
+		putDeltas(column)
+	}
+}
+
+func (b *block) decode(data []byte, rows int) error {
+	b.reset()
+
+	in := bytes.NewReader(data)
+
+	readStrings := func(column []string) ([]string, error) {
+		count, err := binary.ReadUvarint(in)
+		if err != nil || count > uint64(rows) {
+			return nil, ErrCorrupt
+		}
+
+		names := make([]string, count)
+		for i := range names {
+			size, err := binary.ReadUvarint(in)
+			if err != nil || size > uint64(in.Len()) {
+				return nil, ErrCorrupt
+			}
+
+			name := make([]byte, size)
+			if _, err := io.ReadFull(in, name); err != nil {
+				return nil, ErrCorrupt
+			}
+
+			names[i] = string(name)
+		}
+
+		for i := 0; i < rows; i++ {
+			index, err := binary.ReadUvarint(in)
+			if err != nil || index >= count {
+				return nil, ErrCorrupt
+			}
+
+			column = append(column, names[index])
+		}
+
+		return column, nil
+	}
+
+	var err error
+
+	if b.tickers, err = readStrings(b.tickers); err != nil {
+		return err
+	}
+
+	if b.hasUsers {
+		if b.users, err = readStrings(b.users); err != nil {
+			return err
+		}
+	}
+
+	readDeltas := func(column []int64) ([]int64, error) {
+		previous := int64(0)
+		for i := 0; i < rows; i++ {
+			delta, err := binary.ReadVarint(in)
+			if err != nil {
+				return nil, ErrCorrupt
+			}
+
+			previous += delta
+			column = append(column, previous)
+		}
+
+		return column, nil
+	}
+
+	if b.times, err = readDeltas(b.times); err != nil {
+		return err
+	}
+
+	for i := range b.values {
+		if b.values[i], err = readDeltas(b.values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func corrupt(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrCorrupt, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,234 @@
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/usertrade"
+)
+
+var start = time.Date(2019, 1, 30, 7, 0, 0, 0, time.UTC)
+
+func testCandles(n int) []candle.Candle {
+	candles := make([]candle.Candle, n)
+	for i := range candles {
+		price := decimal.FromUnits(int64(100000000 + i*100))
+		candles[i] = candle.Candle{
+			Ticker:       []string{"AAPL", "SBER"}[i%2],
+			Timestamp:    start.Add(time.Duration(i) * time.Minute),
+			OpeningPrice: price,
+			MaxPrice:     price.Add(decimal.FromInt(1)),
+			MinPrice:     price.Sub(decimal.FromInt(1)),
+			ClosingPrice: price,
+			Volume:       int64(i + 1),
+			Turnover:     price.MulInt(int64(i + 1)),
+			Trades:       1,
+			VWAP:         price,
+		}
+	}
+
+	return candles
+}
+
+func writeCandles(t *testing.T, candles []candle.Candle) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w, err := NewCandleWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range candles {
+		if err := w.Write(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func readCandles(t *testing.T, r *CandleReader) []candle.Candle {
+	t.Helper()
+
+	var candles []candle.Candle
+
+	for {
+		c, err := r.Read()
+		if err == io.EOF {
+			return candles
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		candles = append(candles, c)
+	}
+}
+
+func TestCandleRoundTrip(t *testing.T) {
+	want := testCandles(2*BlockRows + 10)
+	data := writeCandles(t, want)
+
+	r, err := NewCandleReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := readCandles(t, r)
+	if len(got) != len(want) {
+		t.Fatalf("read %d candles, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("candle %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	from, to := want[BlockRows+1].Timestamp, want[BlockRows+5].Timestamp
+	r.Seek(from, to)
+
+	if got := readCandles(t, r); len(got) != 4 || !got[0].Timestamp.Equal(from) {
+		t.Errorf("seek read %d candles from %v, want 4 from %v", len(got), got[0].Timestamp, from)
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	data := writeCandles(t, nil)
+
+	r, err := NewCandleReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("%d byte file: %s", len(data), err)
+	}
+
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+// withColumns rewrites the value column count in the header of a file with no rows.
+func withColumns(data []byte, columns uint64) []byte {
+	header := len(magic) + 2
+	rest := data[header+1:]
+
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], columns)
+
+	out := append(append(append([]byte(nil), data[:header]...), scratch[:n]...), rest...)
+
+	// The index follows the header, move its offset by the change in the header size.
+	trailer := out[len(out)-trailerSize:]
+	offset := binary.LittleEndian.Uint64(trailer[:8])
+	binary.LittleEndian.PutUint64(trailer[:8], offset+uint64(n-1))
+
+	return out
+}
+
+func TestColumnCount(t *testing.T) {
+	empty := writeCandles(t, nil)
+
+	for _, tc := range []struct {
+		columns uint64
+		err     error
+	}{
+		{columns: candleColumns},
+		{columns: 4, err: ErrCorrupt},
+		{columns: 5, err: ErrCorrupt},
+		{columns: 1 << 62, err: ErrCorrupt},
+	} {
+		data := withColumns(empty, tc.columns)
+
+		_, err := NewCandleReader(bytes.NewReader(data), int64(len(data)))
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%d columns: got %v, want %v", tc.columns, err, tc.err)
+		}
+	}
+}
+
+func TestShortFile(t *testing.T) {
+	data := writeCandles(t, nil)
+
+	for size := 0; size < len(data); size++ {
+		if _, err := NewCandleReader(bytes.NewReader(data[:size]), int64(size)); err == nil {
+			t.Errorf("%d of %d bytes read without an error", size, len(data))
+		}
+	}
+}
+
+func TestKind(t *testing.T) {
+	data := writeCandles(t, testCandles(3))
+
+	if _, err := NewTradeReader(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrKind) {
+		t.Errorf("got %v, want %v", err, ErrKind)
+	}
+}
+
+func TestUserTradeRoundTrip(t *testing.T) {
+	want := make([]usertrade.Trade, BlockRows+10)
+	for i := range want {
+		want[i] = usertrade.Trade{
+			UserID:    []string{"1", "2", "3"}[i%3],
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Ticker:    []string{"AAPL", "SBER"}[i%2],
+			Lots:      int64(i%5 + 1),
+		}
+
+		if i%2 == 0 {
+			want[i].BuyPrice = decimal.FromUnits(int64(100000000 + i))
+		} else {
+			want[i].SellPrice = decimal.FromUnits(int64(100000000 - i))
+		}
+	}
+
+	var buf bytes.Buffer
+
+	w, err := NewUserTradeWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, trade := range want {
+		if err := w.Write(trade); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewUserTradeReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Seek(want[BlockRows-2].Timestamp, time.Time{})
+
+	for i := BlockRows - 2; i < len(want); i++ {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("trade %d: %s", i, err)
+		}
+
+		if got != want[i] {
+			t.Fatalf("trade %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("got %v after the last trade, want io.EOF", err)
+	}
+}
@@ -0,0 +1,319 @@
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/internal/readat"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/usertrade"
+)
+
+// reader walks the blocks that overlap the [from, to) time range and the rows within it.
+type reader struct {
+	in    io.ReaderAt
+	index []blockInfo
+	from  int64
+	to    int64
+	next  int
+	block *block
+	row   int
+	data  []byte
+}
+
+// newReader opens a file of the kind, which has the given number of value columns.
+func newReader(in io.ReaderAt, size int64, kind byte, columns int) (*reader, error) {
+	head := make([]byte, len(magic)+2+binary.MaxVarintLen64)
+	if size < int64(len(head)) {
+		head = head[:size]
+	}
+
+	if len(head) < len(magic)+2 {
+		return nil, ErrFormat
+	}
+
+	if err := readat.Full(in, head, 0); err != nil {
+		return nil, err
+	}
+
+	if string(head[:len(magic)]) != magic || head[len(magic)] != version {
+		return nil, ErrFormat
+	}
+
+	if head[len(magic)+1] != kind {
+		return nil, ErrKind
+	}
+
+	stored, n := binary.Uvarint(head[len(magic)+2:])
+	if n <= 0 {
+		return nil, ErrFormat
+	}
+
+	headerSize := int64(len(magic) + 2 + n)
+	if size < headerSize+trailerSize {
+		return nil, ErrFormat
+	}
+
+	if stored != uint64(columns) {
+		return nil, corrupt("%d value columns, expected %d", stored, columns)
+	}
+
+	trailer := make([]byte, trailerSize)
+	if err := readat.Full(in, trailer, size-trailerSize); err != nil {
+		return nil, err
+	}
+
+	if string(trailer[8:]) != magic {
+		return nil, corrupt("no trailer")
+	}
+
+	indexOffset := int64(binary.LittleEndian.Uint64(trailer[:8]))
+	if indexOffset < headerSize || indexOffset > size-trailerSize {
+		return nil, corrupt("index offset %d out of the file", indexOffset)
+	}
+
+	index, err := readIndex(io.NewSectionReader(in, indexOffset, size-trailerSize-indexOffset), indexOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reader{in: in, index: index, block: newBlock(kind, columns)}
+	r.seek(time.Time{}, time.Time{})
+
+	return r, nil
+}
+
+func readIndex(in io.Reader, limit int64) ([]blockInfo, error) {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewReader(data)
+
+	count, err := binary.ReadUvarint(buf)
+	if err != nil || count > uint64(len(data)) {
+		return nil, corrupt("bad index")
+	}
+
+	index := make([]blockInfo, count)
+
+	for i := range index {
+		var values [3]uint64
+		for j := range values {
+			if values[j], err = binary.ReadUvarint(buf); err != nil {
+				return nil, corrupt("bad index")
+			}
+		}
+
+		info := &index[i]
+		info.offset, info.size, info.rows = int64(values[0]), int64(values[1]), int(values[2])
+
+		if info.minTime, err = binary.ReadVarint(buf); err != nil {
+			return nil, corrupt("bad index")
+		}
+
+		if info.maxTime, err = binary.ReadVarint(buf); err != nil {
+			return nil, corrupt("bad index")
+		}
+
+		// Every row takes at least a byte, which keeps a corrupt row count from
+		// allocating more than the file size.
+		if info.offset < 0 || info.size < 0 || info.offset+info.size > limit || int64(info.rows) > info.size {
+			return nil, corrupt("block %d out of the file", i)
+		}
+	}
+
+	return index, nil
+}
+
+// seek restarts reading from the first block and limits it to the [from, to) range,
+// a zero time leaves that side open.
+func (r *reader) seek(from, to time.Time) {
+	r.from, r.to = math.MinInt64, math.MaxInt64
+
+	if !from.IsZero() {
+		r.from = from.UnixNano()
+	}
+
+	if !to.IsZero() {
+		r.to = to.UnixNano()
+	}
+
+	r.next = 0
+	r.block.reset()
+	r.row = 0
+}
+
+// advance moves to the next row within the range, it returns io.EOF after the last one.
+func (r *reader) advance() error {
+	for {
+		for r.row < r.block.len() {
+			t := r.block.times[r.row]
+			r.row++
+
+			if t >= r.from && t < r.to {
+				return nil
+			}
+		}
+
+		if err := r.loadBlock(); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *reader) loadBlock() error {
+	for ; r.next < len(r.index); r.next++ {
+		info := r.index[r.next]
+		if info.maxTime < r.from || info.minTime >= r.to {
+			continue
+		}
+
+		if int64(cap(r.data)) < info.size {
+			r.data = make([]byte, info.size)
+		}
+
+		r.data = r.data[:info.size]
+		if err := readat.Full(r.in, r.data, info.offset); err != nil {
+			return err
+		}
+
+		if err := r.block.decode(r.data, info.rows); err != nil {
+			return corrupt("block %d", r.next)
+		}
+
+		r.next++
+		r.row = 0
+
+		return nil
+	}
+
+	return io.EOF
+}
+
+// current is the row advance has moved to.
+func (r *reader) current() int {
+	return r.row - 1
+}
+
+// CandleReader reads candles from a columnar file.
+type CandleReader struct {
+	r *reader
+}
+
+func NewCandleReader(in io.ReaderAt, size int64) (*CandleReader, error) {
+	r, err := newReader(in, size, candleKind, candleColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CandleReader{r: r}, nil
+}
+
+// Seek restarts reading and limits it to candles in the [from, to) range. A zero time
+// leaves that side open. Blocks outside the range are not read.
+func (r *CandleReader) Seek(from, to time.Time) {
+	r.r.seek(from, to)
+}
+
+// Read returns the next candle or io.EOF after the last one.
+func (r *CandleReader) Read() (candle.Candle, error) {
+	if err := r.r.advance(); err != nil {
+		return candle.Candle{}, err
+	}
+
+	b, row := r.r.block, r.r.current()
+
+	return candle.Candle{
+		Ticker:       b.tickers[row],
+		Timestamp:    time.Unix(0, b.times[row]).UTC(),
+		OpeningPrice: decimal.FromUnits(b.values[0][row]),
+		MaxPrice:     decimal.FromUnits(b.values[1][row]),
+		MinPrice:     decimal.FromUnits(b.values[2][row]),
+		ClosingPrice: decimal.FromUnits(b.values[3][row]),
+		Volume:       b.values[4][row],
+		Turnover:     decimal.FromUnits(b.values[5][row]),
+		Trades:       b.values[6][row],
+		VWAP:         decimal.FromUnits(b.values[7][row]),
+	}, nil
+}
+
+// TradeReader reads trades from a columnar file.
+type TradeReader struct {
+	r *reader
+}
+
+func NewTradeReader(in io.ReaderAt, size int64) (*TradeReader, error) {
+	r, err := newReader(in, size, tradeKind, tradeColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TradeReader{r: r}, nil
+}
+
+// Seek restarts reading and limits it to trades in the [from, to) range. A zero time
+// leaves that side open. Blocks outside the range are not read.
+func (r *TradeReader) Seek(from, to time.Time) {
+	r.r.seek(from, to)
+}
+
+// Read returns the next trade or io.EOF after the last one.
+func (r *TradeReader) Read() (candle.Trade, error) {
+	if err := r.r.advance(); err != nil {
+		return candle.Trade{}, err
+	}
+
+	b, row := r.r.block, r.r.current()
+
+	return candle.Trade{
+		Ticker:    b.tickers[row],
+		Price:     decimal.FromUnits(b.values[0][row]),
+		Amount:    int(b.values[1][row]),
+		Timestamp: time.Unix(0, b.times[row]).UTC(),
+	}, nil
+}
+
+// UserTradeReader reads user trades from a columnar file.
+type UserTradeReader struct {
+	r *reader
+}
+
+func NewUserTradeReader(in io.ReaderAt, size int64) (*UserTradeReader, error) {
+	r, err := newReader(in, size, userTradeKind, userTradeColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserTradeReader{r: r}, nil
+}
+
+// Seek restarts reading and limits it to user trades in the [from, to) range. A zero
+// time leaves that side open. Blocks outside the range are not read.
+func (r *UserTradeReader) Seek(from, to time.Time) {
+	r.r.seek(from, to)
+}
+
+// Read returns the next user trade or io.EOF after the last one.
+func (r *UserTradeReader) Read() (usertrade.Trade, error) {
+	if err := r.r.advance(); err != nil {
+		return usertrade.Trade{}, err
+	}
+
+	b, row := r.r.block, r.r.current()
+
+	return usertrade.Trade{
+		UserID:    b.users[row],
+		Timestamp: time.Unix(0, b.times[row]).UTC(),
+		Ticker:    b.tickers[row],
+		BuyPrice:  decimal.FromUnits(b.values[0][row]),
+		SellPrice: decimal.FromUnits(b.values[1][row]),
+		Lots:      b.values[2][row],
+	}, nil
+}
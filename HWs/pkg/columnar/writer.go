@@ -0,0 +1,184 @@
+package columnar
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/usertrade"
+)
+
+// writer buffers rows into blocks and writes the index when closed.
+type writer struct {
+	out    io.Writer
+	offset int64
+	block  *block
+	index  []blockInfo
+	buf    bytes.Buffer
+}
+
+func newWriter(out io.Writer, kind byte, columns int) (*writer, error) {
+	w := &writer{out: out, block: newBlock(kind, columns)}
+
+	var scratch [binary.MaxVarintLen64]byte
+
+	w.buf.WriteString(magic)
+	w.buf.WriteByte(version)
+	w.buf.WriteByte(kind)
+	w.buf.Write(scratch[:binary.PutUvarint(scratch[:], uint64(columns))])
+
+	if err := w.writeBuffer(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *writer) writeBuffer() error {
+	n, err := w.out.Write(w.buf.Bytes())
+	w.offset += int64(n)
+	w.buf.Reset()
+
+	return err
+}
+
+func (w *writer) add(ticker string, timestamp time.Time, values ...int64) error {
+	w.block.tickers = append(w.block.tickers, ticker)
+	w.block.times = append(w.block.times, timestamp.UnixNano())
+
+	for i, value := range values {
+		w.block.values[i] = append(w.block.values[i], value)
+	}
+
+	if w.block.len() < BlockRows {
+		return nil
+	}
+
+	return w.flush()
+}
+
+func (w *writer) flush() error {
+	if w.block.len() == 0 {
+		return nil
+	}
+
+	info := blockInfo{offset: w.offset, rows: w.block.len()}
+	info.minTime, info.maxTime = w.block.timeRange()
+
+	w.block.encode(&w.buf)
+	info.size = int64(w.buf.Len())
+	w.block.reset()
+
+	w.index = append(w.index, info)
+
+	return w.writeBuffer()
+}
+
+func (w *writer) close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	var scratch [binary.MaxVarintLen64]byte
+
+	putUvarint := func(value uint64) {
+		w.buf.Write(scratch[:binary.PutUvarint(scratch[:], value)])
+	}
+
+	putVarint := func(value int64) {
+		w.buf.Write(scratch[:binary.PutVarint(scratch[:], value)])
+	}
+
+	indexOffset := w.offset
+
+	putUvarint(uint64(len(w.index)))
+
+	for _, info := range w.index {
+		putUvarint(uint64(info.offset))
+		putUvarint(uint64(info.size))
+		putUvarint(uint64(info.rows))
+		putVarint(info.minTime)
+		putVarint(info.maxTime)
+	}
+
+	binary.LittleEndian.PutUint64(scratch[:8], uint64(indexOffset))
+	w.buf.Write(scratch[:8])
+	w.buf.WriteString(magic)
+
+	return w.writeBuffer()
+}
+
+// CandleWriter writes candles to a columnar file. Close must be called to write the
+// index, it does not close the underlying writer.
+type CandleWriter struct {
+	w *writer
+}
+
+func NewCandleWriter(out io.Writer) (*CandleWriter, error) {
+	w, err := newWriter(out, candleKind, candleColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CandleWriter{w: w}, nil
+}
+
+func (w *CandleWriter) Write(c candle.Candle) error {
+	return w.w.add(c.Ticker, c.Timestamp,
+		c.OpeningPrice.Units(), c.MaxPrice.Units(), c.MinPrice.Units(), c.ClosingPrice.Units(),
+		c.Volume, c.Turnover.Units(), c.Trades, c.VWAP.Units())
+}
+
+func (w *CandleWriter) Close() error {
+	return w.w.close()
+}
+
+// TradeWriter writes trades to a columnar file. Close must be called to write the
+// index, it does not close the underlying writer.
+type TradeWriter struct {
+	w *writer
+}
+
+func NewTradeWriter(out io.Writer) (*TradeWriter, error) {
+	w, err := newWriter(out, tradeKind, tradeColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TradeWriter{w: w}, nil
+}
+
+func (w *TradeWriter) Write(trade candle.Trade) error {
+	return w.w.add(trade.Ticker, trade.Timestamp, trade.Price.Units(), int64(trade.Amount))
+}
+
+func (w *TradeWriter) Close() error {
+	return w.w.close()
+}
+
+// UserTradeWriter writes user trades to a columnar file. Close must be called to write
+// the index, it does not close the underlying writer.
+type UserTradeWriter struct {
+	w *writer
+}
+
+func NewUserTradeWriter(out io.Writer) (*UserTradeWriter, error) {
+	w, err := newWriter(out, userTradeKind, userTradeColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserTradeWriter{w: w}, nil
+}
+
+func (w *UserTradeWriter) Write(trade usertrade.Trade) error {
+	w.w.block.users = append(w.w.block.users, trade.UserID)
+
+	return w.w.add(trade.Ticker, trade.Timestamp, trade.BuyPrice.Units(), trade.SellPrice.Units(), trade.Lots)
+}
+
+func (w *UserTradeWriter) Close() error {
+	return w.w.close()
+}
@@ -0,0 +1,425 @@
+// Package decimal implements fixed-point numbers for prices and money amounts.
+package decimal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Scale is the number of digits kept after the decimal point.
+const Scale = 6
+
+const unit = 1000000
+
+var (
+	ErrSyntax   = errors.New("invalid decimal syntax")
+	ErrRange    = errors.New("decimal value out of range")
+	ErrDivision = errors.New("division by zero")
+)
+
+// Decimal is a signed fixed-point number with Scale digits after the point, its range
+// is that of an int64 number of units. The zero value is 0.
+//
+// Operations that can leave the range come in pairs: New, FromInt, Add, Sub, Mul and
+// MulInt panic with ErrRange and are meant for values known to fit, while CheckedNew,
+// CheckedFromInt, CheckedAdd, CheckedSub, CheckedMul and CheckedMulInt return the error.
+// Amounts read from input should go through the checked ones.
+type Decimal struct {
+	units int64
+}
+
+var Zero = Decimal{}
+
+// New returns value * 10^-exp, e.g. New(21310, 2) is 213.1. Digits beyond Scale are
+// truncated.
+func New(value int64, exp int) Decimal {
+	return must(CheckedNew(value, exp))
+}
+
+// CheckedNew is New that returns ErrRange on overflow.
+func CheckedNew(value int64, exp int) (Decimal, error) {
+	units := value
+	for ; exp < Scale && units != 0; exp++ {
+		if units > math.MaxInt64/10 || units < math.MinInt64/10 {
+			return Zero, ErrRange
+		}
+
+		units *= 10
+	}
+
+	for ; exp > Scale && units != 0; exp-- {
+		units /= 10
+	}
+
+	return Decimal{units: units}, nil
+}
+
+// FromInt converts a whole number, e.g. a count.
+func FromInt(value int64) Decimal {
+	return must(CheckedFromInt(value))
+}
+
+// CheckedFromInt is FromInt that returns ErrRange on overflow.
+func CheckedFromInt(value int64) (Decimal, error) {
+	return Decimal{units: value}.CheckedMulInt(unit)
+}
+
+// FromUnits builds a decimal from its raw representation, see Units.
+func FromUnits(units int64) Decimal {
+	return Decimal{units: units}
+}
+
+// Parse reads a plain decimal number like "-213.10". Digits beyond Scale are rejected
+// instead of being rounded silently.
+func Parse(s string) (Decimal, error) {
+	if s == "" {
+		return Zero, fmt.Errorf("parse %q: %w", s, ErrSyntax)
+	}
+
+	str := s
+	negative := false
+	if str[0] == '-' || str[0] == '+' {
+		negative = str[0] == '-'
+		str = str[1:]
+	}
+
+	intPart, fracPart := str, ""
+	if dot := strings.IndexByte(str, '.'); dot >= 0 {
+		intPart, fracPart = str[:dot], str[dot+1:]
+	}
+
+	if intPart == "" && fracPart == "" {
+		return Zero, fmt.Errorf("parse %q: %w", s, ErrSyntax)
+	}
+
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > Scale {
+		return Zero, fmt.Errorf("parse %q: more than %d fractional digits: %w", s, Scale, ErrSyntax)
+	}
+
+	var units uint64
+	for _, digits := range []string{intPart, fracPart + strings.Repeat("0", Scale-len(fracPart))} {
+		for i := 0; i < len(digits); i++ {
+			c := digits[i]
+			if c < '0' || c > '9' {
+				return Zero, fmt.Errorf("parse %q: %w", s, ErrSyntax)
+			}
+
+			hi, lo := bits.Mul64(units, 10)
+			lo, carry := bits.Add64(lo, uint64(c-'0'), 0)
+			if hi != 0 || carry != 0 || lo > math.MaxInt64 {
+				return Zero, fmt.Errorf("parse %q: %w", s, ErrRange)
+			}
+
+			units = lo
+		}
+	}
+
+	if negative {
+		return Decimal{units: -int64(units)}, nil
+	}
+
+	return Decimal{units: int64(units)}, nil
+}
+
+// MustParse is like Parse but panics on error. It is meant for constants.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
+
+// Units returns the raw representation: the value multiplied by 10^Scale.
+func (d Decimal) Units() int64 {
+	return d.units
+}
+
+func (d Decimal) Add(other Decimal) Decimal {
+	return must(d.CheckedAdd(other))
+}
+
+// CheckedAdd is Add that returns ErrRange on overflow.
+func (d Decimal) CheckedAdd(other Decimal) (Decimal, error) {
+	sum := d.units + other.units
+	if (other.units > 0 && sum < d.units) || (other.units < 0 && sum > d.units) {
+		return Zero, ErrRange
+	}
+
+	return Decimal{units: sum}, nil
+}
+
+func (d Decimal) Sub(other Decimal) Decimal {
+	return must(d.CheckedSub(other))
+}
+
+// CheckedSub is Sub that returns ErrRange on overflow.
+func (d Decimal) CheckedSub(other Decimal) (Decimal, error) {
+	difference := d.units - other.units
+	if (other.units < 0 && difference < d.units) || (other.units > 0 && difference > d.units) {
+		return Zero, ErrRange
+	}
+
+	return Decimal{units: difference}, nil
+}
+
+// Neg panics with ErrRange for the smallest decimal, whose negation does not fit.
+func (d Decimal) Neg() Decimal {
+	if d.units == math.MinInt64 {
+		panic(ErrRange)
+	}
+
+	return Decimal{units: -d.units}
+}
+
+// Mul multiplies two decimals, the result is truncated towards zero to Scale digits.
+func (d Decimal) Mul(other Decimal) Decimal {
+	return must(d.CheckedMul(other))
+}
+
+// CheckedMul is Mul that returns ErrRange on overflow.
+func (d Decimal) CheckedMul(other Decimal) (Decimal, error) {
+	hi, lo := bits.Mul64(abs(d.units), abs(other.units))
+	if hi >= unit {
+		return Zero, ErrRange
+	}
+
+	quo, _ := bits.Div64(hi, lo, unit)
+
+	return signed(quo, (d.units < 0) != (other.units < 0))
+}
+
+// MulInt multiplies a decimal by an integer, e.g. a price by a quantity.
+func (d Decimal) MulInt(n int64) Decimal {
+	return must(d.CheckedMulInt(n))
+}
+
+// CheckedMulInt is MulInt that returns ErrRange on overflow.
+func (d Decimal) CheckedMulInt(n int64) (Decimal, error) {
+	hi, lo := bits.Mul64(abs(d.units), abs(n))
+	if hi != 0 {
+		return Zero, ErrRange
+	}
+
+	return signed(lo, (d.units < 0) != (n < 0))
+}
+
+// Div divides two decimals, the result is truncated towards zero to Scale digits.
+func (d Decimal) Div(other Decimal) (Decimal, error) {
+	if other.units == 0 {
+		return Zero, ErrDivision
+	}
+
+	hi, lo := bits.Mul64(abs(d.units), unit)
+	divisor := abs(other.units)
+	if hi >= divisor {
+		return Zero, ErrRange
+	}
+
+	quo, _ := bits.Div64(hi, lo, divisor)
+
+	return signed(quo, (d.units < 0) != (other.units < 0))
+}
+
+// Cmp returns -1, 0 or +1 when d is less than, equal to or greater than other.
+func (d Decimal) Cmp(other Decimal) int {
+	switch {
+	case d.units < other.units:
+		return -1
+	case d.units > other.units:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (d Decimal) Equal(other Decimal) bool {
+	return d.units == other.units
+}
+
+func (d Decimal) LessThan(other Decimal) bool {
+	return d.units < other.units
+}
+
+func (d Decimal) GreaterThan(other Decimal) bool {
+	return d.units > other.units
+}
+
+func (d Decimal) IsZero() bool {
+	return d.units == 0
+}
+
+func (d Decimal) IsNegative() bool {
+	return d.units < 0
+}
+
+// Sign returns -1, 0 or +1.
+func (d Decimal) Sign() int {
+	return d.Cmp(Zero)
+}
+
+// Abs panics with ErrRange for the smallest decimal, like Neg.
+func (d Decimal) Abs() Decimal {
+	if d.units < 0 {
+		return d.Neg()
+	}
+
+	return d
+}
+
+// Round rounds half away from zero to the given number of fractional digits. It panics
+// with ErrRange when the rounded value does not fit, which only happens within half a
+// step of the range limits.
+func (d Decimal) Round(places int) Decimal {
+	return must(signed(roundUnits(abs(d.units), places), d.units < 0))
+}
+
+// Float64 converts the decimal for statistics where exactness is not needed.
+func (d Decimal) Float64() float64 {
+	return float64(d.units) / unit
+}
+
+// String formats the decimal with as few fractional digits as needed: 213.1, 5, -0.25.
+func (d Decimal) String() string {
+	sign := ""
+	if d.units < 0 {
+		sign = "-"
+	}
+
+	units := abs(d.units)
+	intPart := strconv.FormatUint(units/unit, 10)
+
+	frac := units % unit
+	if frac == 0 {
+		return sign + intPart
+	}
+
+	fracPart := strconv.FormatUint(frac+unit, 10)[1:]
+
+	return sign + intPart + "." + strings.TrimRight(fracPart, "0")
+}
+
+// StringFixed formats the decimal with exactly places fractional digits, rounding half
+// away from zero.
+func (d Decimal) StringFixed(places int) string {
+	if places > Scale {
+		places = Scale
+	}
+
+	sign := ""
+	if d.units < 0 {
+		sign = "-"
+	}
+
+	units := roundUnits(abs(d.units), places)
+	if units == 0 {
+		sign = ""
+	}
+
+	intPart := strconv.FormatUint(units/unit, 10)
+	if places <= 0 {
+		return sign + intPart
+	}
+
+	fracPart := strconv.FormatUint(units%unit+unit, 10)[1 : 1+places]
+
+	return sign + intPart + "." + fracPart
+}
+
+func (d Decimal) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+
+	return nil
+}
+
+// MarshalJSON writes the decimal as a JSON number so no precision is lost.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	return d.UnmarshalText([]byte(strings.Trim(string(data), `"`)))
+}
+
+func Min(lhs, rhs Decimal) Decimal {
+	if rhs.units < lhs.units {
+		return rhs
+	}
+
+	return lhs
+}
+
+func Max(lhs, rhs Decimal) Decimal {
+	if rhs.units > lhs.units {
+		return rhs
+	}
+
+	return lhs
+}
+
+func abs(value int64) uint64 {
+	if value < 0 {
+		return uint64(-value)
+	}
+
+	return uint64(value)
+}
+
+// roundUnits rounds a number of units half up to places fractional digits. The result
+// may be out of the int64 range, but always fits a uint64.
+func roundUnits(units uint64, places int) uint64 {
+	// Rounding to 10^19 units or more gives zero or 10^19 units.
+	if places < Scale-19 {
+		places = Scale - 19
+	}
+
+	step := uint64(1)
+	for i := places; i < Scale; i++ {
+		step *= 10
+	}
+
+	rest := units % step
+	if rest >= step-rest {
+		return units - rest + step
+	}
+
+	return units - rest
+}
+
+// signed makes a decimal of the magnitude and the sign, or returns ErrRange.
+func signed(units uint64, negative bool) (Decimal, error) {
+	switch {
+	case negative && units == 1<<63:
+		return Decimal{units: math.MinInt64}, nil
+	case units > math.MaxInt64:
+		return Zero, ErrRange
+	case negative:
+		return Decimal{units: -int64(units)}, nil
+	default:
+		return Decimal{units: int64(units)}, nil
+	}
+}
+
+// must panics with the error of a checked operation.
+func must(d Decimal, err error) Decimal {
+	if err != nil {
+		panic(err)
+	}
+
+	return d
+}
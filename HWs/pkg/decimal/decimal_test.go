@@ -0,0 +1,244 @@
+package decimal
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+var (
+	largest  = FromUnits(math.MaxInt64)
+	smallest = FromUnits(math.MinInt64)
+)
+
+func TestParse(t *testing.T) {
+	for input, tc := range map[string]struct {
+		want string
+		err  error
+	}{
+		"213.10":                 {want: "213.1"},
+		"-0.25":                  {want: "-0.25"},
+		"+5":                     {want: "5"},
+		".5":                     {want: "0.5"},
+		"5.":                     {want: "5"},
+		"-0":                     {want: "0"},
+		"0.000001":               {want: "0.000001"},
+		"1.1234560":              {want: "1.123456"},
+		"9223372036854.775807":   {want: "9223372036854.775807"},
+		"-9223372036854.775807":  {want: "-9223372036854.775807"},
+		"1.0000001":              {err: ErrSyntax},
+		"":                       {err: ErrSyntax},
+		"-":                      {err: ErrSyntax},
+		".":                      {err: ErrSyntax},
+		"1e5":                    {err: ErrSyntax},
+		" 1":                     {err: ErrSyntax},
+		"1,5":                    {err: ErrSyntax},
+		"--1":                    {err: ErrSyntax},
+		"9223372036854.775808":   {err: ErrRange},
+		"-9223372036854.775808":  {err: ErrRange},
+		"100000000000000000000":  {err: ErrRange},
+		"1844674407370955161600": {err: ErrRange},
+	} {
+		d, err := Parse(input)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("Parse(%q): got error %v, want %v", input, err, tc.err)
+			continue
+		}
+
+		if err == nil && d.String() != tc.want {
+			t.Errorf("Parse(%q) = %s, want %s", input, d, tc.want)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	for _, tc := range []struct {
+		value  string
+		places int
+		want   string
+	}{
+		{value: "1.234565", places: 5, want: "1.23457"},
+		{value: "-1.234565", places: 5, want: "-1.23457"},
+		{value: "1.234564", places: 5, want: "1.23456"},
+		{value: "2.5", places: 0, want: "3"},
+		{value: "-2.5", places: 0, want: "-3"},
+		{value: "1.499999", places: 0, want: "1"},
+		{value: "-0.000001", places: 2, want: "0"},
+		{value: "0.000001", places: Scale, want: "0.000001"},
+		{value: "0.000001", places: Scale + 1, want: "0.000001"},
+		{value: "15", places: -1, want: "20"},
+		{value: "-12.5", places: -1, want: "-10"},
+		{value: "4000000000000", places: -20, want: "0"},
+	} {
+		if got := MustParse(tc.value).Round(tc.places); got.String() != tc.want {
+			t.Errorf("Round(%s, %d) = %s, want %s", tc.value, tc.places, got, tc.want)
+		}
+	}
+}
+
+func TestStringFixed(t *testing.T) {
+	for _, tc := range []struct {
+		value  Decimal
+		places int
+		want   string
+	}{
+		{value: MustParse("0.125"), places: 2, want: "0.13"},
+		{value: MustParse("-0.125"), places: 2, want: "-0.13"},
+		{value: MustParse("-0.001"), places: 2, want: "0.00"},
+		{value: MustParse("7"), places: 3, want: "7.000"},
+		{value: MustParse("0.000001"), places: 8, want: "0.000001"},
+		{value: MustParse("99.5"), places: 0, want: "100"},
+		// Rounding would take these out of the range, formatting them still works.
+		{value: largest, places: 0, want: "9223372036855"},
+		{value: smallest, places: 2, want: "-9223372036854.78"},
+	} {
+		if got := tc.value.StringFixed(tc.places); got != tc.want {
+			t.Errorf("%s.StringFixed(%d) = %s, want %s", tc.value, tc.places, got, tc.want)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	negative, positive := MustParse("-0.25"), MustParse("0.25")
+
+	if negative.Sign() != -1 || Zero.Sign() != 0 || positive.Sign() != 1 {
+		t.Errorf("signs of %s, 0 and %s: %d, %d, %d", negative, positive, negative.Sign(), Zero.Sign(), positive.Sign())
+	}
+
+	if !negative.Neg().Equal(positive) || !negative.Abs().Equal(positive) || !positive.Abs().Equal(positive) {
+		t.Errorf("Neg and Abs of %s and %s", negative, positive)
+	}
+
+	if !negative.IsNegative() || Zero.IsNegative() || Zero.Neg() != Zero {
+		t.Errorf("IsNegative of %s and 0, or -0 is not 0", negative)
+	}
+
+	if negative.Cmp(positive) != -1 || positive.Cmp(negative) != 1 || Min(negative, positive) != negative ||
+		Max(negative, positive) != positive {
+		t.Errorf("%s and %s compare wrong", negative, positive)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	third, err := FromInt(1).Div(FromInt(3))
+	if err != nil || third.String() != "0.333333" {
+		t.Errorf("1/3 = %s, %v", third, err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{name: "add", got: MustParse("0.1").Add(MustParse("0.2")), want: "0.3"},
+		{name: "sub", got: MustParse("0.1").Sub(MustParse("0.25")), want: "-0.15"},
+		{name: "mul truncates", got: MustParse("0.000001").Mul(MustParse("0.5")), want: "0"},
+		{name: "mul sign", got: MustParse("-1.5").Mul(MustParse("2.5")), want: "-3.75"},
+		{name: "mul int", got: MustParse("161.22").MulInt(-3), want: "-483.66"},
+		{name: "new", got: New(21310, 2), want: "213.1"},
+		{name: "new truncates", got: New(-1234567891, 9), want: "-1.234567"},
+		{name: "new far below the scale", got: New(5, 1000), want: "0"},
+		{name: "from int", got: FromInt(-7), want: "-7"},
+		{name: "smallest times one", got: smallest.MulInt(1), want: smallest.String()},
+	} {
+		if tc.got.String() != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.name, tc.got, tc.want)
+		}
+	}
+
+	for divisor, want := range map[string]string{"-3": "0.333333", "0.5": "-2", "3": "-0.333333"} {
+		quotient, err := FromInt(-1).Div(MustParse(divisor))
+		if err != nil || quotient.String() != want {
+			t.Errorf("-1/%s = %s, %v, want %s", divisor, quotient, err, want)
+		}
+	}
+
+	if _, err := FromInt(1).Div(Zero); !errors.Is(err, ErrDivision) {
+		t.Errorf("1/0: got %v, want %v", err, ErrDivision)
+	}
+}
+
+// TestOverflow checks every operation that can leave the range: the checked ones return
+// ErrRange and the others panic with it.
+func TestOverflow(t *testing.T) {
+	unitDecimal := FromUnits(1)
+
+	checked := map[string]func() (Decimal, error){
+		"new":               func() (Decimal, error) { return CheckedNew(math.MaxInt64, 0) },
+		"new negative":      func() (Decimal, error) { return CheckedNew(-1, -13) },
+		"from int":          func() (Decimal, error) { return CheckedFromInt(math.MaxInt64/unit + 1) },
+		"from int negative": func() (Decimal, error) { return CheckedFromInt(math.MinInt64/unit - 1) },
+		"add":               func() (Decimal, error) { return largest.CheckedAdd(unitDecimal) },
+		"add negative":      func() (Decimal, error) { return smallest.CheckedAdd(unitDecimal.Neg()) },
+		"sub":               func() (Decimal, error) { return smallest.CheckedSub(unitDecimal) },
+		"sub negative":      func() (Decimal, error) { return largest.CheckedSub(unitDecimal.Neg()) },
+		"mul":               func() (Decimal, error) { return largest.CheckedMul(MustParse("1.000001")) },
+		"mul high bits":     func() (Decimal, error) { return largest.CheckedMul(largest) },
+		"mul int":           func() (Decimal, error) { return largest.CheckedMulInt(2) },
+		"mul int smallest":  func() (Decimal, error) { return smallest.CheckedMulInt(-1) },
+		"div":               func() (Decimal, error) { return largest.Div(MustParse("0.5")) },
+		"parse":             func() (Decimal, error) { return Parse("9999999999999") },
+	}
+
+	for name, operation := range checked {
+		if d, err := operation(); !errors.Is(err, ErrRange) {
+			t.Errorf("%s: got %s, %v, want %v", name, d, err, ErrRange)
+		}
+	}
+
+	for name, operation := range map[string]func(){
+		"new":      func() { New(math.MaxInt64, 0) },
+		"from int": func() { FromInt(math.MaxInt64) },
+		"add":      func() { largest.Add(unitDecimal) },
+		"sub":      func() { smallest.Sub(unitDecimal) },
+		"mul":      func() { largest.Mul(FromInt(2)) },
+		"mul int":  func() { largest.MulInt(2) },
+		"neg":      func() { smallest.Neg() },
+		"abs":      func() { smallest.Abs() },
+		"round":    func() { largest.Round(0) },
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r != ErrRange { //nolint
+					t.Errorf("%s: got panic %v, want %v", name, r, ErrRange)
+				}
+			}()
+
+			operation()
+		}()
+	}
+
+	// The limits themselves are in range.
+	if d, err := largest.Sub(unitDecimal).CheckedAdd(unitDecimal); err != nil || d != largest {
+		t.Errorf("largest - 1 + 1 = %s, %v", d, err)
+	}
+
+	if d, err := CheckedFromInt(math.MaxInt64 / unit); err != nil || d.Units() != math.MaxInt64/unit*unit {
+		t.Errorf("from the biggest int: %s, %v", d, err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var prices struct {
+		Number Decimal `json:"number"`
+		String Decimal `json:"string"`
+	}
+
+	if err := json.Unmarshal([]byte(`{"number": 0.05, "string": "-213.1"}`), &prices); err != nil {
+		t.Fatal(err)
+	}
+
+	if prices.Number.String() != "0.05" || prices.String.String() != "-213.1" {
+		t.Errorf("got %s and %s", prices.Number, prices.String)
+	}
+
+	data, err := json.Marshal(prices)
+	if err != nil || string(data) != `{"number":0.05,"string":-213.1}` {
+		t.Errorf("got %s, %v", data, err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"number": 1e3}`), &prices); !errors.Is(err, ErrSyntax) {
+		t.Errorf("got %v, want %v", err, ErrSyntax)
+	}
+}
@@ -0,0 +1,19 @@
+// Package readat has the ReaderAt helper the file format readers share.
+package readat
+
+import "io"
+
+// Full fills p from the offset, a full read at the end of the input is not an error.
+// A short read is io.ErrUnexpectedEOF.
+func Full(in io.ReaderAt, p []byte, offset int64) error {
+	n, err := in.ReadAt(p, offset)
+	if n == len(p) {
+		return nil
+	}
+
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
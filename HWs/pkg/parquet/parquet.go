@@ -0,0 +1,299 @@
+// Package parquet writes and reads candles as Apache Parquet files.
+//
+// The file has one row group per RowGroupSize candles and one uncompressed, PLAIN
+// encoded data page per column chunk. Its schema is:
+//
+//	required binary ticker (STRING);
+//	required int64 timestamp (TIMESTAMP(MICROS, true));
+//	required int64 open (DECIMAL(18, 6));
+//	required int64 high (DECIMAL(18, 6));
+//	required int64 low (DECIMAL(18, 6));
+//	required int64 close (DECIMAL(18, 6));
+//	required int64 volume;
+//	required int64 turnover (DECIMAL(18, 6));
+//	required int64 trades;
+//	required int64 vwap (DECIMAL(18, 6));
+//
+// The reader handles files with this layout, the columns after close are optional. It also accepts other INT64 timestamp
+// units and decimal scales, but not compression, dictionary pages or optional columns.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+const magic = "PAR1"
+
+// RowGroupSize is the number of candles in a row group.
+const RowGroupSize = 64 * 1024
+
+// Parquet enums, see parquet.thrift.
+const (
+	int64Type     int32 = 2
+	byteArrayType int32 = 6
+
+	requiredRepetition int32 = 0
+
+	utf8Converted            int32 = 0
+	decimalConverted         int32 = 5
+	timestampMillisConverted int32 = 9
+	timestampMicrosConverted int32 = 10
+
+	plainEncoding int32 = 0
+	rleEncoding   int32 = 3
+
+	uncompressed int32 = 0
+
+	dataPage int32 = 0
+
+	priceScale     = decimal.Scale
+	pricePrecision = 18
+)
+
+var ErrUnsupported = errors.New("unsupported parquet file")
+
+// column is how a candle field is stored.
+type column struct {
+	name    string
+	schema  thriftStruct
+	typ     int32
+	encode  func(out *bytes.Buffer, c *candle.Candle)
+	scratch [8]byte
+}
+
+func int64Column(name string, value func(c *candle.Candle) int64, schema ...field) *column {
+	col := &column{name: name, typ: int64Type}
+
+	col.schema = append(thriftStruct{
+		{1, int64Type},
+		{3, requiredRepetition},
+		{4, name},
+	}, schema...)
+
+	col.encode = func(out *bytes.Buffer, c *candle.Candle) {
+		binary.LittleEndian.PutUint64(col.scratch[:], uint64(value(c)))
+		out.Write(col.scratch[:])
+	}
+
+	return col
+}
+
+func priceColumn(name string, price func(c *candle.Candle) decimal.Decimal) *column {
+	return int64Column(name, func(c *candle.Candle) int64 { return price(c).Units() },
+		field{6, decimalConverted},
+		field{7, int32(priceScale)},
+		field{8, int32(pricePrecision)},
+		field{10, thriftStruct{{5, thriftStruct{{1, int32(priceScale)}, {2, int32(pricePrecision)}}}}},
+	)
+}
+
+func candleColumns() []*column {
+	ticker := &column{
+		name: "ticker",
+		typ:  byteArrayType,
+		schema: thriftStruct{
+			{1, byteArrayType},
+			{3, requiredRepetition},
+			{4, "ticker"},
+			{6, utf8Converted},
+			{10, thriftStruct{{1, thriftStruct{}}}},
+		},
+	}
+
+	ticker.encode = func(out *bytes.Buffer, c *candle.Candle) {
+		binary.LittleEndian.PutUint32(ticker.scratch[:4], uint32(len(c.Ticker)))
+		out.Write(ticker.scratch[:4])
+		out.WriteString(c.Ticker)
+	}
+
+	// Microseconds cover any year, unlike UnixNano.
+	micros := func(c *candle.Candle) int64 {
+		return c.Timestamp.Unix()*1e6 + int64(c.Timestamp.Nanosecond()/1e3)
+	}
+
+	timestamp := int64Column("timestamp", micros,
+		field{6, timestampMicrosConverted},
+		field{10, thriftStruct{{8, thriftStruct{{1, true}, {2, thriftStruct{{2, thriftStruct{}}}}}}}},
+	)
+
+	return []*column{
+		ticker,
+		timestamp,
+		priceColumn("open", func(c *candle.Candle) decimal.Decimal { return c.OpeningPrice }),
+		priceColumn("high", func(c *candle.Candle) decimal.Decimal { return c.MaxPrice }),
+		priceColumn("low", func(c *candle.Candle) decimal.Decimal { return c.MinPrice }),
+		priceColumn("close", func(c *candle.Candle) decimal.Decimal { return c.ClosingPrice }),
+		int64Column("volume", func(c *candle.Candle) int64 { return c.Volume }),
+		priceColumn("turnover", func(c *candle.Candle) decimal.Decimal { return c.Turnover }),
+		int64Column("trades", func(c *candle.Candle) int64 { return c.Trades }),
+		priceColumn("vwap", func(c *candle.Candle) decimal.Decimal { return c.VWAP }),
+	}
+}
+
+// Writer writes candles to a Parquet file. Close must be called to write the footer,
+// it does not close the underlying writer.
+type Writer struct {
+	out       io.Writer
+	offset    int64
+	columns   []*column
+	pending   []candle.Candle
+	rowGroups thriftList
+	rows      int64
+	page      bytes.Buffer
+}
+
+func NewWriter(out io.Writer) *Writer {
+	return &Writer{out: out, columns: candleColumns()}
+}
+
+func (w *Writer) write(data []byte) error {
+	n, err := w.out.Write(data)
+	w.offset += int64(n)
+
+	return err
+}
+
+func (w *Writer) Write(candles []candle.Candle) error {
+	if w.offset == 0 {
+		if err := w.write([]byte(magic)); err != nil {
+			return err
+		}
+	}
+
+	for len(candles) > 0 {
+		n := RowGroupSize - len(w.pending)
+		if n > len(candles) {
+			n = len(candles)
+		}
+
+		w.pending = append(w.pending, candles[:n]...)
+		candles = candles[n:]
+
+		if len(w.pending) == RowGroupSize {
+			if err := w.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// flush writes the pending candles as a row group.
+func (w *Writer) flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+
+	rows := len(w.pending)
+	chunks := make(thriftList, 0, len(w.columns))
+	groupSize := int64(0)
+
+	for _, col := range w.columns {
+		w.page.Reset()
+		for i := range w.pending {
+			col.encode(&w.page, &w.pending[i])
+		}
+
+		var header encoder
+		header.writeStruct(thriftStruct{
+			{1, dataPage},
+			{2, int32(w.page.Len())},
+			{3, int32(w.page.Len())},
+			{5, thriftStruct{
+				{1, int32(rows)},
+				{2, plainEncoding},
+				{3, rleEncoding},
+				{4, rleEncoding},
+			}},
+		})
+
+		start := w.offset
+		size := int64(header.buf.Len() + w.page.Len())
+
+		if err := w.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+
+		if err := w.write(w.page.Bytes()); err != nil {
+			return err
+		}
+
+		chunks = append(chunks, thriftStruct{
+			{2, start},
+			{3, thriftStruct{
+				{1, col.typ},
+				{2, thriftList{plainEncoding, rleEncoding}},
+				{3, thriftList{col.name}},
+				{4, uncompressed},
+				{5, int64(rows)},
+				{6, size},
+				{7, size},
+				{9, start},
+			}},
+		})
+
+		groupSize += size
+	}
+
+	w.rowGroups = append(w.rowGroups, thriftStruct{
+		{1, chunks},
+		{2, groupSize},
+		{3, int64(rows)},
+	})
+
+	w.rows += int64(rows)
+	w.pending = w.pending[:0]
+
+	return nil
+}
+
+func (w *Writer) Close() error {
+	if w.offset == 0 {
+		if err := w.write([]byte(magic)); err != nil {
+			return err
+		}
+	}
+
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	schema := thriftList{thriftStruct{{4, "schema"}, {5, int32(len(w.columns))}}}
+	for _, col := range w.columns {
+		schema = append(schema, col.schema)
+	}
+
+	var footer encoder
+	footer.writeStruct(thriftStruct{
+		{1, int32(1)},
+		{2, schema},
+		{3, w.rows},
+		{4, w.rowGroups},
+		{6, "tinkoff-golang version 1.0.0"},
+	})
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(footer.buf.Len()))
+
+	footer.buf.Write(length[:])
+	footer.buf.WriteString(magic)
+
+	return w.write(footer.buf.Bytes())
+}
+
+// WriteCandles writes the candles as a whole Parquet file.
+func WriteCandles(out io.Writer, candles []candle.Candle) error {
+	w := NewWriter(out)
+	if err := w.Write(candles); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,227 @@
+package parquet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+var update = flag.Bool("update", false, "rewrite testdata/candles.parquet")
+
+var start = time.Date(2019, 1, 30, 7, 0, 0, 0, time.UTC)
+
+// goldenCandles are the candles of testdata/candles.parquet.
+func goldenCandles() []candle.Candle {
+	var candles []candle.Candle
+
+	for i, ticker := range []string{"AAPL", "AAPL", "AAPL", "SBER", "SBER", "ΩMEGA"} {
+		price := decimal.New(int64(16122+i*7), 2)
+
+		c := candle.Candle{
+			Ticker:       ticker,
+			Timestamp:    start.Add(time.Duration(i%3) * 5 * time.Minute),
+			OpeningPrice: price,
+			MaxPrice:     price.Add(decimal.New(166, 2)),
+			MinPrice:     price.Sub(decimal.New(497, 2)),
+			ClosingPrice: price.Add(decimal.New(1, 6)),
+		}
+
+		if i != 2 {
+			c.Stats([]candle.Trade{
+				{Ticker: ticker, Price: c.OpeningPrice, Amount: 10 * (i + 1)},
+				{Ticker: ticker, Price: c.ClosingPrice, Amount: 3},
+			}) //nolint
+		}
+
+		candles = append(candles, c)
+	}
+
+	return candles
+}
+
+func equalCandles(t *testing.T, got, want []candle.Candle) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d candles, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("candle %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func roundTrip(t *testing.T, candles []candle.Candle) []candle.Candle {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := WriteCandles(&buf, candles); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadCandles(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return got
+}
+
+func TestRoundTrip(t *testing.T) {
+	candles := make([]candle.Candle, RowGroupSize+10)
+	for i := range candles {
+		price := decimal.FromUnits(int64(100000000 + i))
+		candles[i] = candle.Candle{
+			Ticker:       []string{"AAPL", "AMZN", "SBER"}[i%3],
+			Timestamp:    start.Add(time.Duration(i) * time.Minute),
+			OpeningPrice: price,
+			MaxPrice:     price,
+			MinPrice:     price,
+			ClosingPrice: price,
+			Volume:       int64(i),
+			Turnover:     price.MulInt(int64(i)),
+			Trades:       int64(i % 7),
+			VWAP:         price,
+		}
+	}
+
+	equalCandles(t, roundTrip(t, candles), candles)
+}
+
+func TestEmpty(t *testing.T) {
+	if got := roundTrip(t, nil); len(got) != 0 {
+		t.Errorf("read %d candles from an empty file", len(got))
+	}
+}
+
+// TestGolden keeps the encoding of the writer fixed. testdata/candles.csv is what the
+// Apache Arrow Go reader (pqarrow) reads from testdata/candles.parquet.
+func TestGolden(t *testing.T) {
+	golden := filepath.Join("testdata", "candles.parquet")
+
+	var buf bytes.Buffer
+	if err := WriteCandles(&buf, goldenCandles()); err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := ioutil.WriteFile(golden, buf.Bytes(), 0o644); err != nil { //nolint
+			t.Fatal(err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("the writer output differs from %s, run the tests with -update if that is intended", golden)
+	}
+
+	equalCandles(t, readFile(t, golden), goldenCandles())
+	equalCandles(t, readCSV(t, filepath.Join("testdata", "candles.csv")), goldenCandles())
+}
+
+// TestExternalFile reads testdata/arrow.parquet, written by the Apache Arrow Go writer
+// with dictionaries and compression off, millisecond timestamps and decimals as INT64.
+func TestExternalFile(t *testing.T) {
+	want := goldenCandles()
+	equalCandles(t, readFile(t, filepath.Join("testdata", "arrow.parquet")), want)
+}
+
+func TestNotParquet(t *testing.T) {
+	data := []byte("ticker,timestamp\nAAPL,2019-01-30T07:00:00Z\n")
+
+	if _, err := ReadCandles(bytes.NewReader(data), int64(len(data))); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func readFile(t *testing.T, filename string) []candle.Candle {
+	t.Helper()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	candles, err := ReadCandles(file, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return candles
+}
+
+// readCSV reads ticker,timestamp,open,high,low,close,volume,turnover,trades,vwap rows.
+func readCSV(t *testing.T, filename string) []candle.Candle {
+	t.Helper()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	var candles []candle.Candle
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ",")
+		if len(fields) != len(candle.Columns) {
+			t.Fatalf("bad line %q", scanner.Text())
+		}
+
+		var c candle.Candle
+
+		c.Ticker = fields[0]
+		if c.Timestamp, err = time.Parse(time.RFC3339, fields[1]); err != nil {
+			t.Fatal(err)
+		}
+
+		decimals := map[int]*decimal.Decimal{
+			2: &c.OpeningPrice, 3: &c.MaxPrice, 4: &c.MinPrice, 5: &c.ClosingPrice, 7: &c.Turnover, 9: &c.VWAP,
+		}
+		for i, value := range decimals {
+			*value = decimal.MustParse(fields[i])
+		}
+
+		if c.Volume, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+			t.Fatal(err)
+		}
+
+		if c.Trades, err = strconv.ParseInt(fields[8], 10, 64); err != nil {
+			t.Fatal(err)
+		}
+
+		candles = append(candles, c)
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return candles
+}
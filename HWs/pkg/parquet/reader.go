@@ -0,0 +1,392 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/internal/readat"
+)
+
+type thriftFields = map[int16]interface{}
+
+func getInt(s thriftFields, id int16) (int64, bool) {
+	value, ok := s[id].(int64)
+	return value, ok
+}
+
+func getString(s thriftFields, id int16) string {
+	value, _ := s[id].([]byte)
+	return string(value)
+}
+
+func getList(s thriftFields, id int16) []interface{} {
+	value, _ := s[id].([]interface{})
+	return value
+}
+
+func getStruct(s thriftFields, id int16) thriftFields {
+	value, _ := s[id].(thriftFields)
+	return value
+}
+
+// columnInfo is what the reader needs from a schema element.
+type columnInfo struct {
+	typ   int64
+	scale int
+	unit  time.Duration
+}
+
+func readSchema(elements []interface{}) (map[string]columnInfo, error) {
+	columns := make(map[string]columnInfo)
+
+	for i, element := range elements {
+		if i == 0 {
+			continue
+		}
+
+		s, ok := element.(thriftFields)
+		if !ok {
+			return nil, errThrift
+		}
+
+		name := getString(s, 4)
+
+		if children, ok := getInt(s, 5); ok && children > 0 {
+			return nil, fmt.Errorf("%w: nested column %s", ErrUnsupported, name)
+		}
+
+		if repetition, _ := getInt(s, 3); repetition != int64(requiredRepetition) {
+			return nil, fmt.Errorf("%w: column %s is not required", ErrUnsupported, name)
+		}
+
+		info := columnInfo{unit: time.Microsecond}
+		info.typ, _ = getInt(s, 1)
+
+		scale, _ := getInt(s, 7)
+		info.scale = int(scale)
+
+		converted, ok := getInt(s, 6)
+		if ok && converted == int64(timestampMillisConverted) {
+			info.unit = time.Millisecond
+		}
+
+		if unit := getStruct(getStruct(getStruct(s, 10), 8), 2); unit != nil {
+			switch {
+			case unit[1] != nil:
+				info.unit = time.Millisecond
+			case unit[3] != nil:
+				info.unit = time.Nanosecond
+			}
+		}
+
+		columns[name] = info
+	}
+
+	return columns, nil
+}
+
+// chunk holds the values of a column in a row group.
+type chunk struct {
+	ints    []int64
+	strings []string
+}
+
+func readChunk(in io.ReaderAt, meta thriftFields, typ int64) (*chunk, error) {
+	if codec, _ := getInt(meta, 4); codec != int64(uncompressed) {
+		return nil, fmt.Errorf("%w: compressed column", ErrUnsupported)
+	}
+
+	if _, ok := getInt(meta, 11); ok {
+		return nil, fmt.Errorf("%w: dictionary page", ErrUnsupported)
+	}
+
+	values, _ := getInt(meta, 5)
+	offset, _ := getInt(meta, 9)
+	size, _ := getInt(meta, 7)
+
+	if values < 0 || offset < 0 || size < 0 || values > size {
+		return nil, errThrift
+	}
+
+	data := make([]byte, size)
+	if err := readat.Full(in, data, offset); err != nil {
+		return nil, err
+	}
+
+	pages := bytes.NewReader(data)
+	result := &chunk{}
+
+	for read := int64(0); read < values; {
+		header, err := (&decoder{in: pages}).readStruct()
+		if err != nil {
+			return nil, err
+		}
+
+		if pageType, _ := getInt(header, 1); pageType != int64(dataPage) {
+			return nil, fmt.Errorf("%w: page type %d", ErrUnsupported, pageType)
+		}
+
+		pageSize, _ := getInt(header, 3)
+		if pageSize < 0 || pageSize > int64(pages.Len()) {
+			return nil, errThrift
+		}
+
+		dataHeader := getStruct(header, 5)
+		count, _ := getInt(dataHeader, 1)
+
+		if encoding, _ := getInt(dataHeader, 2); encoding != int64(plainEncoding) {
+			return nil, fmt.Errorf("%w: encoding %d", ErrUnsupported, encoding)
+		}
+
+		page := make([]byte, pageSize)
+		if _, err := io.ReadFull(pages, page); err != nil {
+			return nil, errThrift
+		}
+
+		if err := result.decode(page, count, typ); err != nil {
+			return nil, err
+		}
+
+		read += count
+	}
+
+	return result, nil
+}
+
+func (c *chunk) decode(page []byte, count, typ int64) error {
+	switch typ {
+	case int64(int64Type):
+		if int64(len(page)) < count*8 || count < 0 {
+			return errThrift
+		}
+
+		for i := int64(0); i < count; i++ {
+			c.ints = append(c.ints, int64(binary.LittleEndian.Uint64(page[i*8:])))
+		}
+	case int64(byteArrayType):
+		for i := int64(0); i < count; i++ {
+			if len(page) < 4 {
+				return errThrift
+			}
+
+			size := binary.LittleEndian.Uint32(page)
+			page = page[4:]
+
+			if uint64(len(page)) < uint64(size) {
+				return errThrift
+			}
+
+			c.strings = append(c.strings, string(page[:size]))
+			page = page[size:]
+		}
+	default:
+		return fmt.Errorf("%w: physical type %d", ErrUnsupported, typ)
+	}
+
+	return nil
+}
+
+// ReadCandles reads all candles of a Parquet file, see the package comment for the
+// files it can read.
+func ReadCandles(in io.ReaderAt, size int64) ([]candle.Candle, error) {
+	if size < int64(2*len(magic)+4) {
+		return nil, ErrUnsupported
+	}
+
+	tail := make([]byte, 4+len(magic))
+	if err := readat.Full(in, tail, size-int64(len(tail))); err != nil {
+		return nil, err
+	}
+
+	if string(tail[4:]) != magic {
+		return nil, fmt.Errorf("%w: no parquet footer", ErrUnsupported)
+	}
+
+	length := int64(binary.LittleEndian.Uint32(tail))
+	if length > size-int64(len(tail)+len(magic)) {
+		return nil, errThrift
+	}
+
+	footer := make([]byte, length)
+	if err := readat.Full(in, footer, size-int64(len(tail))-length); err != nil {
+		return nil, err
+	}
+
+	meta, err := (&decoder{in: bytes.NewReader(footer)}).readStruct()
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := readSchema(getList(meta, 2))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{"ticker", "timestamp", "open", "high", "low", "close"} {
+		if _, ok := schema[name]; !ok {
+			return nil, fmt.Errorf("%w: no %s column", ErrUnsupported, name)
+		}
+	}
+
+	var candles []candle.Candle
+
+	for _, group := range getList(meta, 4) {
+		group, ok := group.(thriftFields)
+		if !ok {
+			return nil, errThrift
+		}
+
+		rows, _ := getInt(group, 3)
+		chunks := make(map[string]*chunk)
+
+		for _, col := range getList(group, 1) {
+			col, ok := col.(thriftFields)
+			if !ok {
+				return nil, errThrift
+			}
+
+			colMeta := getStruct(col, 3)
+
+			path := getList(colMeta, 3)
+			if len(path) != 1 {
+				return nil, fmt.Errorf("%w: nested column", ErrUnsupported)
+			}
+
+			name, ok := path[0].([]byte)
+			if !ok {
+				return nil, errThrift
+			}
+
+			info, ok := schema[string(name)]
+			if !ok {
+				return nil, errThrift
+			}
+
+			if chunks[string(name)], err = readChunk(in, colMeta, info.typ); err != nil {
+				return nil, err
+			}
+		}
+
+		if candles, err = appendRows(candles, rows, chunks, schema); err != nil {
+			return nil, err
+		}
+	}
+
+	return candles, nil
+}
+
+func fromUnit(value int64, unit time.Duration) time.Time {
+	perSecond := int64(time.Second / unit)
+	return time.Unix(value/perSecond, value%perSecond*int64(unit)).UTC()
+}
+
+func appendRows(candles []candle.Candle, rows int64, chunks map[string]*chunk,
+	schema map[string]columnInfo) ([]candle.Candle, error) {
+	ints := func(name string) ([]int64, error) {
+		c := chunks[name]
+		if c == nil || int64(len(c.ints)) != rows {
+			return nil, fmt.Errorf("%w: bad %s column", ErrUnsupported, name)
+		}
+
+		return c.ints, nil
+	}
+
+	tickers := chunks["ticker"]
+	if tickers == nil || int64(len(tickers.strings)) != rows {
+		return nil, fmt.Errorf("%w: bad ticker column", ErrUnsupported)
+	}
+
+	timestamps, err := ints("timestamp")
+	if err != nil {
+		return nil, err
+	}
+
+	// A scale below Scale multiplies the stored integers, which may leave the decimal range.
+	decimals := func(name string) ([]decimal.Decimal, error) {
+		values, err := ints(name)
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]decimal.Decimal, len(values))
+		for i, value := range values {
+			if result[i], err = decimal.CheckedNew(value, schema[name].scale); err != nil {
+				return nil, fmt.Errorf("column %s row %d: %w", name, i, err)
+			}
+		}
+
+		return result, nil
+	}
+
+	var prices [4][]decimal.Decimal
+	for i, name := range []string{"open", "high", "low", "close"} {
+		if prices[i], err = decimals(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var volumes, trades []int64
+	var turnovers, vwaps []decimal.Decimal
+
+	if _, ok := chunks["volume"]; ok {
+		if volumes, err = ints("volume"); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := chunks["turnover"]; ok {
+		if turnovers, err = decimals("turnover"); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := chunks["trades"]; ok {
+		if trades, err = ints("trades"); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, ok := chunks["vwap"]; ok {
+		if vwaps, err = decimals("vwap"); err != nil {
+			return nil, err
+		}
+	}
+
+	unit := schema["timestamp"].unit
+
+	for i := int64(0); i < rows; i++ {
+		c := candle.Candle{
+			Ticker:       tickers.strings[i],
+			Timestamp:    fromUnit(timestamps[i], unit),
+			OpeningPrice: prices[0][i],
+			MaxPrice:     prices[1][i],
+			MinPrice:     prices[2][i],
+			ClosingPrice: prices[3][i],
+		}
+
+		if volumes != nil {
+			c.Volume = volumes[i]
+		}
+
+		if turnovers != nil {
+			c.Turnover = turnovers[i]
+		}
+
+		if trades != nil {
+			c.Trades = trades[i]
+		}
+
+		if vwaps != nil {
+			c.VWAP = vwaps[i]
+		}
+
+		candles = append(candles, c)
+	}
+
+	return candles, nil
+}
@@ -0,0 +1,306 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Parquet metadata is serialized with the Thrift compact protocol. Only the parts the
+// file metadata and page headers need are implemented.
+
+const (
+	typeStop   = 0
+	typeTrue   = 1
+	typeFalse  = 2
+	typeByte   = 3
+	typeI16    = 4
+	typeI32    = 5
+	typeI64    = 6
+	typeDouble = 7
+	typeBinary = 8
+	typeList   = 9
+	typeSet    = 10
+	typeMap    = 11
+	typeStruct = 12
+
+	maxDepth = 32
+)
+
+var errThrift = errors.New("malformed thrift data")
+
+type field struct {
+	id    int16
+	value interface{}
+}
+
+// thriftStruct is a struct to encode with its fields in increasing id order. Field values
+// are bool, int16, int32, int64, string, thriftList or thriftStruct.
+type thriftStruct []field
+
+// thriftList is a list to encode, all of its elements have the same type.
+type thriftList []interface{}
+
+func thriftType(value interface{}) byte {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return typeTrue
+		}
+
+		return typeFalse
+	case int16:
+		return typeI16
+	case int32:
+		return typeI32
+	case int64:
+		return typeI64
+	case string:
+		return typeBinary
+	case thriftList:
+		return typeList
+	case thriftStruct:
+		return typeStruct
+	default:
+		panic(fmt.Sprintf("parquet: no thrift type for %T", value))
+	}
+}
+
+type encoder struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) uvarint(value uint64) {
+	e.buf.Write(e.scratch[:binary.PutUvarint(e.scratch[:], value)])
+}
+
+// varint writes a zigzag varint, which is how the compact protocol writes integers.
+func (e *encoder) varint(value int64) {
+	e.buf.Write(e.scratch[:binary.PutVarint(e.scratch[:], value)])
+}
+
+func (e *encoder) writeStruct(s thriftStruct) {
+	last := int16(0)
+
+	for _, f := range s {
+		typ := thriftType(f.value)
+
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			e.buf.WriteByte(byte(delta)<<4 | typ)
+		} else {
+			e.buf.WriteByte(typ)
+			e.varint(int64(f.id))
+		}
+
+		last = f.id
+
+		// A bool field is all in its type.
+		if _, ok := f.value.(bool); !ok {
+			e.writeValue(f.value)
+		}
+	}
+
+	e.buf.WriteByte(typeStop)
+}
+
+func (e *encoder) writeValue(value interface{}) {
+	switch v := value.(type) {
+	case int16:
+		e.varint(int64(v))
+	case int32:
+		e.varint(int64(v))
+	case int64:
+		e.varint(v)
+	case string:
+		e.uvarint(uint64(len(v)))
+		e.buf.WriteString(v)
+	case thriftList:
+		typ := byte(typeStruct)
+		if len(v) > 0 {
+			typ = thriftType(v[0])
+		}
+
+		if len(v) < 15 {
+			e.buf.WriteByte(byte(len(v))<<4 | typ)
+		} else {
+			e.buf.WriteByte(0xf0 | typ)
+			e.uvarint(uint64(len(v)))
+		}
+
+		for _, element := range v {
+			e.writeValue(element)
+		}
+	case thriftStruct:
+		e.writeStruct(v)
+	default:
+		panic(fmt.Sprintf("parquet: can't encode %T in thrift", value))
+	}
+}
+
+// decoder reads compact protocol data into generic values: structs become
+// map[int16]interface{}, lists []interface{}, integers int64, binaries []byte.
+type decoder struct {
+	in    *bytes.Reader
+	depth int
+}
+
+func (d *decoder) readStruct() (map[int16]interface{}, error) {
+	fields := make(map[int16]interface{})
+	last := int16(0)
+
+	for {
+		header, err := d.in.ReadByte()
+		if err != nil {
+			return nil, errThrift
+		}
+
+		typ := header & 0x0f
+		if typ == typeStop {
+			return fields, nil
+		}
+
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			long, err := binary.ReadVarint(d.in)
+			if err != nil {
+				return nil, errThrift
+			}
+
+			id = int16(long)
+		}
+
+		last = id
+
+		switch typ {
+		case typeTrue:
+			fields[id] = true
+		case typeFalse:
+			fields[id] = false
+		default:
+			if fields[id], err = d.readValue(typ); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (d *decoder) readValue(typ byte) (interface{}, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+
+	if d.depth > maxDepth {
+		return nil, errThrift
+	}
+
+	switch typ {
+	case typeTrue, typeFalse:
+		// Bool list elements take a byte of their own.
+		b, err := d.in.ReadByte()
+		if err != nil {
+			return nil, errThrift
+		}
+
+		return b == typeTrue, nil
+	case typeByte:
+		b, err := d.in.ReadByte()
+		if err != nil {
+			return nil, errThrift
+		}
+
+		return int64(int8(b)), nil
+	case typeI16, typeI32, typeI64:
+		value, err := binary.ReadVarint(d.in)
+		if err != nil {
+			return nil, errThrift
+		}
+
+		return value, nil
+	case typeDouble:
+		var value [8]byte
+		if _, err := io.ReadFull(d.in, value[:]); err != nil {
+			return nil, errThrift
+		}
+
+		return value, nil
+	case typeBinary:
+		size, err := binary.ReadUvarint(d.in)
+		if err != nil || size > uint64(d.in.Len()) {
+			return nil, errThrift
+		}
+
+		value := make([]byte, size)
+		if _, err := io.ReadFull(d.in, value); err != nil {
+			return nil, errThrift
+		}
+
+		return value, nil
+	case typeList, typeSet:
+		return d.readList()
+	case typeMap:
+		return d.readMap()
+	case typeStruct:
+		return d.readStruct()
+	default:
+		return nil, errThrift
+	}
+}
+
+func (d *decoder) readList() ([]interface{}, error) {
+	header, err := d.in.ReadByte()
+	if err != nil {
+		return nil, errThrift
+	}
+
+	size := uint64(header >> 4)
+	if size == 15 {
+		if size, err = binary.ReadUvarint(d.in); err != nil {
+			return nil, errThrift
+		}
+	}
+
+	// Every element takes at least a byte.
+	if size > uint64(d.in.Len()) {
+		return nil, errThrift
+	}
+
+	list := make([]interface{}, size)
+	for i := range list {
+		if list[i], err = d.readValue(header & 0x0f); err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
+}
+
+// readMap skips a map, the metadata read here has none.
+func (d *decoder) readMap() (interface{}, error) {
+	size, err := binary.ReadUvarint(d.in)
+	if err != nil || size > uint64(d.in.Len()) {
+		return nil, errThrift
+	}
+
+	if size == 0 {
+		return nil, nil
+	}
+
+	types, err := d.in.ReadByte()
+	if err != nil {
+		return nil, errThrift
+	}
+
+	for i := uint64(0); i < size; i++ {
+		if _, err := d.readValue(types >> 4); err != nil {
+			return nil, err
+		}
+
+		if _, err := d.readValue(types & 0x0f); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
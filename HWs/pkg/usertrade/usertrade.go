@@ -0,0 +1,96 @@
+// Package usertrade parses the user trades of hw1's user_trades.csv, one per line:
+//
+//	user_id,time,ticker,buy_price,sell_price[,quantity]
+//
+// with an RFC 3339 time. A trade is a buy when the buy price is set and a sell when
+// the sell price is. The quantity is in lots of the instrument and defaults to one lot.
+//
+// Parse only reads the fields, the checks of the trade itself are left to hw1.
+package usertrade
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+type Trade struct {
+	UserID    string
+	Timestamp time.Time
+	Ticker    string
+	BuyPrice  decimal.Decimal
+	SellPrice decimal.Decimal
+	Lots      int64
+}
+
+// Columns are the names of the fields of a record, the last one is optional.
+var Columns = []string{"user_id", "time", "ticker", "buy_price", "sell_price", "quantity"}
+
+var ErrFieldCount = errors.New("expected 5 or 6 fields")
+
+// FieldError reports a field that can't be parsed.
+type FieldError struct {
+	Field string
+	Value string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %q: %s", e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Parse reads a record. The prices and the quantity may be surrounded by spaces, an
+// empty quantity is one lot.
+func Parse(record []string) (Trade, error) {
+	if len(record) != len(Columns)-1 && len(record) != len(Columns) {
+		return Trade{}, fmt.Errorf("%w, got %d", ErrFieldCount, len(record))
+	}
+
+	fail := func(field int, err error) (Trade, error) {
+		return Trade{}, &FieldError{Field: Columns[field], Value: record[field], Err: err}
+	}
+
+	trade := Trade{UserID: record[0], Ticker: record[2], Lots: 1}
+
+	var err error
+
+	if trade.Timestamp, err = time.Parse(time.RFC3339, record[1]); err != nil {
+		return fail(1, err)
+	}
+
+	if trade.BuyPrice, err = decimal.Parse(strings.TrimSpace(record[3])); err != nil {
+		return fail(3, err)
+	}
+
+	if trade.SellPrice, err = decimal.Parse(strings.TrimSpace(record[4])); err != nil {
+		return fail(4, err)
+	}
+
+	if len(record) == len(Columns) && record[5] != "" {
+		if trade.Lots, err = strconv.ParseInt(strings.TrimSpace(record[5]), 10, 64); err != nil {
+			return fail(5, err)
+		}
+	}
+
+	return trade, nil
+}
+
+// Record is the record of the trade, with the quantity.
+func (t Trade) Record() []string {
+	return []string{
+		t.UserID,
+		t.Timestamp.Format(time.RFC3339),
+		t.Ticker,
+		t.BuyPrice.String(),
+		t.SellPrice.String(),
+		strconv.FormatInt(t.Lots, 10),
+	}
+}
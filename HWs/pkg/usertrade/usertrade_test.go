@@ -0,0 +1,77 @@
+package usertrade
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/decimal"
+)
+
+func TestParse(t *testing.T) {
+	at := time.Date(2019, 1, 30, 7, 0, 11, 0, time.UTC)
+
+	tests := map[string]struct {
+		want  Trade
+		field string
+		err   error
+	}{
+		"11012,2019-01-30T07:00:11Z,AAPL,161.22,0": {
+			want: Trade{UserID: "11012", Timestamp: at, Ticker: "AAPL", BuyPrice: decimal.MustParse("161.22"), Lots: 1},
+		},
+		"11012,2019-01-30T07:00:11Z,AAPL,0, 161.22 , 3 ": {
+			want: Trade{UserID: "11012", Timestamp: at, Ticker: "AAPL", SellPrice: decimal.MustParse("161.22"), Lots: 3},
+		},
+		"11012,2019-01-30T07:00:11Z,AAPL,161.22,0,": {
+			want: Trade{UserID: "11012", Timestamp: at, Ticker: "AAPL", BuyPrice: decimal.MustParse("161.22"), Lots: 1},
+		},
+		"11012,2019-01-30T07:00:11Z,AAPL,161.22":           {err: ErrFieldCount},
+		"11012,2019-01-30T07:00:11Z,AAPL,161.22,0,1,x":     {err: ErrFieldCount},
+		"11012,2019-01-30 07:00:11,AAPL,161.22,0":          {field: "time"},
+		"11012,2019-01-30T07:00:11Z,AAPL,x,0":              {field: "buy_price", err: decimal.ErrSyntax},
+		"11012,2019-01-30T07:00:11Z,AAPL,0,1e3":            {field: "sell_price", err: decimal.ErrSyntax},
+		"11012,2019-01-30T07:00:11Z,AAPL,0,1.0000001":      {field: "sell_price", err: decimal.ErrSyntax},
+		"11012,2019-01-30T07:00:11Z,AAPL,0,1,two":          {field: "quantity"},
+		"11012,2019-01-30T07:00:11Z,AAPL,99999999999999,0": {field: "buy_price", err: decimal.ErrRange},
+	}
+
+	for line, tt := range tests {
+		got, err := Parse(strings.Split(line, ","))
+
+		if wantErr := tt.field != "" || tt.err != nil; (err != nil) != wantErr {
+			t.Errorf("%s: got error %v, want error %t", line, err, wantErr)
+			continue
+		}
+
+		if err == nil {
+			if got != tt.want {
+				t.Errorf("%s: got %+v, want %+v", line, got, tt.want)
+			}
+
+			continue
+		}
+
+		var fieldErr *FieldError
+		if tt.field != "" && (!errors.As(err, &fieldErr) || fieldErr.Field != tt.field) {
+			t.Errorf("%s: got error %v, want an error of field %s", line, err, tt.field)
+		}
+
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v, want %v", line, err, tt.err)
+		}
+	}
+}
+
+func TestRecord(t *testing.T) {
+	record := []string{"11012", "2019-01-30T07:00:11Z", "AAPL", "0", "161.22", "3"}
+
+	trade, err := Parse(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(trade.Record(), ","); got != strings.Join(record, ",") {
+		t.Errorf("got %s, want %s", got, strings.Join(record, ","))
+	}
+}
@@ -0,0 +1,177 @@
+// Command colconv converts candle and trade CSV files to the columnar format, e.g.
+//
+//	colconv -kind trades -in trades.csv -out trades.col
+//	colconv -kind candles -in candles_5m.csv -out candles_5m.col
+//	colconv -kind user-trades -in user_trades.csv -out user_trades.col
+//
+// User trades are hw1's user_id,time,ticker,buy_price,sell_price[,quantity] records, see
+// package usertrade. A record that can't be parsed stops the conversion, the checks of
+// the trades themselves are left to hw1.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/candle"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/columnar"
+	"github.com/tesnikio/tinkoff-golang/HWs/pkg/usertrade"
+)
+
+func convertCandles(in io.Reader, out io.Writer) (int, error) {
+	reader := candle.NewReader(in)
+
+	writer, err := columnar.NewCandleWriter(out)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for {
+		c, err := reader.Read()
+		if err == io.EOF {
+			return count, writer.Close()
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if err := writer.Write(c); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+}
+
+func convertTrades(in io.Reader, out io.Writer) (int, error) {
+	reader := candle.NewTradeReader(in)
+
+	writer, err := columnar.NewTradeWriter(out)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for {
+		trade, err := reader.Read()
+		if err == io.EOF {
+			return count, writer.Close()
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if err := writer.Write(trade); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+}
+
+func convertUserTrades(in io.Reader, out io.Writer) (int, error) {
+	reader := csv.NewReader(in)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	writer, err := columnar.NewUserTradeWriter(out)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return count, writer.Close()
+		}
+		if err != nil {
+			return count, err
+		}
+
+		trade, err := usertrade.Parse(record)
+		if err != nil {
+			line, _ := reader.FieldPos(0)
+			return count, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		if err := writer.Write(trade); err != nil {
+			return count, err
+		}
+
+		count++
+	}
+}
+
+func run(kind, input, output string) error {
+	var convert func(io.Reader, io.Writer) (int, error)
+
+	switch kind {
+	case "candles":
+		convert = convertCandles
+	case "trades":
+		convert = convertTrades
+	case "user-trades":
+		convert = convertUserTrades
+	default:
+		return fmt.Errorf("unknown kind %q, expected candles, trades or user-trades", kind)
+	}
+
+	if input == "" || output == "" {
+		return fmt.Errorf("both -in and -out are required")
+	}
+
+	in, err := os.Open(input)
+	if err != nil {
+		return fmt.Errorf("can't open %s: %s", input, err)
+	}
+
+	defer in.Close()
+
+	out, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("can't create %s: %s", output, err)
+	}
+
+	writer := bufio.NewWriter(out)
+
+	count, err := convert(bufio.NewReader(in), writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("can't convert %s: %s", input, err)
+	}
+
+	fmt.Fprintf(os.Stderr, "converted %d %s from %s to %s\n", count, kind, input, output)
+
+	return nil
+}
+
+func main() {
+	var kind, input, output string
+
+	flag.StringVar(&kind, "kind", "trades", "records in the input: candles, trades or user-trades")
+	flag.StringVar(&input, "in", "", "CSV file to convert")
+	flag.StringVar(&output, "out", "", "columnar file to write")
+	flag.Parse()
+
+	if err := run(kind, input, output); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}